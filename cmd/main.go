@@ -6,32 +6,153 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/prometheus/common/log"
 	"nano-gpu-exporter/pkg/exporter"
+	"nano-gpu-exporter/pkg/kubepods"
+	"nano-gpu-exporter/pkg/nvidia"
+	"nano-gpu-exporter/pkg/ptree"
 	"nano-gpu-exporter/pkg/util"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 )
 
-const Resources = "nvidia.com/gpu, tke.cloud.tencent.com/qgpu-core, tke.cloud.tencent.com/qgpu-memory, nano-gpu/gpu-percent"
-
 var (
 	node      string
 	resources string
 	interval  int
+	backend   string
+	scenario  string
+	workers   int
+	timeout   int
+	groups    string
+	health    bool
+	account   bool
+	driver    string
+	scan      string
+	hostProc  string
+	hostSys   string
+	depth     int
+	threads   bool
+	unrequest bool
+	events    bool
+	assign    bool
+	resSocket string
+	devCheck  string
+	useKube   bool
+	kube      kubepods.ClientConfig
+	qps       float64
 )
 
 func init(){
 	flag.StringVar(&node, "node", "", "node name")
-	flag.StringVar(&resources, "labels", Resources, "gpu resources name")
+	flag.StringVar(&resources, "labels", util.Resources, "gpu resources name")
 	flag.IntVar(&interval, "interval", 30, "monitor interval (second)")
+	flag.StringVar(&backend, "backend", nvidia.BackendNVML, "gpu backend, nvml or simulated")
+	flag.StringVar(&scenario, "scenario", "", "scenario file (yaml or json) played by the simulated backend")
+	flag.IntVar(&workers, "workers", 8, "number of gpu cards sampled at the same time")
+	flag.IntVar(&timeout, "card-timeout", 10, "timeout of sampling one gpu card (second), 0 means no timeout")
+	flag.StringVar(&groups, "metric-groups", strings.Join(nvidia.TelemetryGroups, ","), "card telemetry groups to export: "+strings.Join(nvidia.TelemetryGroups, ", "))
+	flag.BoolVar(&health, "health", true, "watch gpu faults and serve /healthz/gpus")
+	flag.BoolVar(&account, "accounting", false, "turn on gpu accounting mode to catch processes finishing between two intervals")
+	flag.StringVar(&driver, "cgroup-driver", ptree.CgroupDriverAuto, "cgroup driver of the kubelet: "+strings.Join(ptree.CgroupDrivers, ", "))
+	flag.StringVar(&scan, "scanner", "cgroup", "how processes are attributed to pods: cgroup walks the cgroups of every pod, pid reads /proc/<pid>/cgroup of the gpu processes")
+	flag.StringVar(&hostProc, "host-proc", ptree.ProcRoot, "where the host procfs is mounted, /proc outside a container")
+	flag.StringVar(&hostSys, "host-sys", ptree.SysRoot, "where the host sysfs is mounted, /sys outside a container")
+	flag.IntVar(&depth, "cgroup-depth", 0, "levels of child cgroups walked below a container cgroup")
+	flag.BoolVar(&threads, "resolve-threads", false, "attribute the threads found in child cgroups, as in threaded cgroups, to their process")
+	flag.BoolVar(&unrequest, "unrequested", false, "flag pods using gpus without requesting any gpu resource")
+	flag.BoolVar(&events, "unrequested-events", false, "record an event on pods flagged by --unrequested")
+	flag.BoolVar(&assign, "assignment", true, "export the gpus every container was given, read from its environment and device cgroup")
+	flag.StringVar(&resSocket, "pod-resources-socket", "", "socket of the kubelet pod resources API, e.g. "+kubepods.PodResourcesSocket+", to read the devices given to every container; off when empty")
+	flag.StringVar(&devCheck, "device-checkpoint", "", "device plugin checkpoint of the kubelet, e.g. "+kubepods.DeviceCheckpoint+", read when the pod resources API is off or fails; off when empty")
+	flag.BoolVar(&useKube, "kubernetes", true, "watch the pods of the node, only the cards are exported when off")
+	flag.StringVar(&kube.Kubeconfig, "kubeconfig", "", "kubeconfig file, $"+kubepods.RecommendedKubeConfigPathEnv+" then ~/.kube/config when empty and the in-cluster config when none exists")
+	flag.StringVar(&kube.Context, "context", "", "kubeconfig context, the current one when empty")
+	flag.Float64Var(&qps, "kube-api-qps", 0, "requests per second to the kubernetes api server, the client default when 0")
+	flag.IntVar(&kube.Burst, "kube-api-burst", 0, "burst of requests to the kubernetes api server, the client default when 0")
 	flag.Parse()
+	kube.QPS = float32(qps)
 }
 
 func main() {
-	e := exporter.NewExporter(node, strings.Split(resources, ","), time.Duration(interval) * time.Second)
+	device, err := nvidia.NewDevice(backend, scenario)
+	if err != nil {
+		log.Fatal(err)
+	}
+	metricGroups, err := nvidia.ParseGroups(groups)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fs := ptree.NewOSFS()
+	var scanner ptree.Scanner
+	switch scan {
+	case "cgroup":
+		opts := ptree.ScanOptions{MaxDepth: depth}
+		if threads {
+			opts.ProcRoot = hostProc
+		}
+		scanner, err = ptree.NewScanner(fs, hostSys, driver, opts)
+		if err != nil {
+			log.Fatal(err)
+		}
+	case "pid":
+		scanner = ptree.NewPidScanner(fs, hostProc, func() ([]int, error) {
+			return nvidia.Pids(device)
+		})
+	default:
+		log.Fatalf("unknown scanner %q", scan)
+	}
+	var sources kubepods.FallbackSource
+	if resSocket != "" {
+		client, err := kubepods.NewPodResourcesClient(resSocket, 10 * time.Second)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer client.Close()
+		sources = append(sources, client)
+	}
+	if devCheck != "" {
+		sources = append(sources, kubepods.NewCheckpointSource(devCheck))
+	}
+	var allocations kubepods.AllocationSource
+	if len(sources) != 0 {
+		allocations = sources
+	}
+	var monitor *nvidia.HealthMonitor
+	if health {
+		monitor = nvidia.NewHealthMonitor(device, time.Duration(interval) * time.Second)
+		go monitor.Run(util.NeverStop)
+		http.Handle("/healthz/gpus", monitor)
+	}
+	e := exporter.NewExporter(node, util.SplitResources(resources), time.Duration(interval) * time.Second, device, exporter.Options{
+		Workers:      workers,
+		CardTimeout:  time.Duration(timeout) * time.Second,
+		MetricGroups: metricGroups,
+		Health:       monitor,
+		Accounting:   account,
+		Scanner:      scanner,
+		FS:           fs,
+		ProcRoot:     hostProc,
+
+		Unrequested:       unrequest,
+		UnrequestedEvents: events,
+		Assignment:        assign,
+		SysRoot:           hostSys,
+		Allocations:       allocations,
+		Kubernetes:        useKube,
+		Kube:              kube,
+	})
 	go e.Run(util.NeverStop)
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+		<-sig
+		device.Close()
+		os.Exit(0)
+	}()
 
 	http.Handle("/metrics", promhttp.HandlerFor(
 		prometheus.DefaultGatherer,
@@ -2,19 +2,18 @@ module nano-gpu-exporter
 
 go 1.16
 
-//replace tkestack.io/nvml => github.com/alex337/go-nvml v1
-replace tkestack.io/nvml => github.com/tkestack/go-nvml v0.0.0-20191217064248-7363e630a33e
-
 require (
+	github.com/NVIDIA/go-nvml v0.12.0-1
 	github.com/prometheus/client_golang v1.0.0
+	github.com/prometheus/client_model v0.0.0-20190812154241-14fe0d1b01d4
 	github.com/prometheus/common v0.4.1
+	google.golang.org/grpc v1.40.0
+	google.golang.org/protobuf v1.27.1
 	k8s.io/api v0.17.4
 	k8s.io/apimachinery v0.17.4
 	k8s.io/client-go v0.17.4
 	k8s.io/klog v1.0.0
 	k8s.io/klog/v2 v2.20.0
 	k8s.io/kubectl v0.17.4
-	//github.com/alex337/go-nvml v1.0.0
-	tkestack.io/nvml v0.0.0-00010101000000-000000000000
-
+	sigs.k8s.io/yaml v1.1.0
 )
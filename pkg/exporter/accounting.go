@@ -0,0 +1,147 @@
+package exporter
+
+import (
+	"time"
+
+	"nano-gpu-exporter/pkg/nvidia"
+)
+
+// pidOwner is the container a pid was last seen in, seen is when the process tree
+// was scanned or the cgroup of the pid read.
+type pidOwner struct {
+	namespace string
+	pod       string
+	container string
+	seen      time.Time
+}
+
+type containerKey struct {
+	namespace string
+	pod       string
+	container string
+}
+
+// finishedKey identifies a finished process of a card; pids are reused, start times
+// are not.
+type finishedKey struct {
+	uuid  string
+	pid   int
+	start time.Time
+}
+
+// finishedUsage is what the processes of a container which finished during a cycle
+// used. Core is their SM utilization spread over the cycle, MaxMem the most memory
+// one of them used.
+type finishedUsage struct {
+	count  float64
+	core   float64
+	maxMem float64
+}
+
+// accounting attributes the processes kept by accounting mode after they exited to
+// the containers they were seen in while alive. Owners and reported processes are
+// forgotten after retain.
+type accounting struct {
+	interval time.Duration
+	retain   time.Duration
+	owners   map[int]pidOwner
+	reported map[finishedKey]time.Time
+	// lookup reads the container of a pid the process tree did not see from its
+	// cgroup, clock tells when a cycle ends.
+	lookup func(pid int) (pidOwner, bool)
+	clock  func() time.Time
+}
+
+func newAccounting(interval time.Duration, lookup func(pid int) (pidOwner, bool)) *accounting {
+	return &accounting{
+		interval: interval,
+		retain:   10 * interval,
+		owners:   make(map[int]pidOwner),
+		reported: make(map[finishedKey]time.Time),
+		lookup:   lookup,
+		clock:    time.Now,
+	}
+}
+
+func (a *accounting) observe(pid int, owner pidOwner) {
+	a.owners[pid] = owner
+}
+
+// resolve gives an owner to the running pids the process tree did not see during
+// the cycle, so that processes living between two scans are attributed once they
+// finished.
+func (a *accounting) resolve(running map[int]struct{}, now time.Time) {
+	from := now.Add(-a.interval)
+	for pid := range running {
+		if owner, ok := a.owners[pid]; ok && !owner.seen.Before(from) {
+			continue
+		}
+		if owner, ok := a.lookup(pid); ok {
+			owner.seen = now
+			a.owners[pid] = owner
+		}
+	}
+}
+
+// attribute adds the finished processes of card uuid not reported yet to usages. A
+// pid is given to the owner it had while the process ran. A process which finished
+// during the cycle without ever being seen is looked up once more, its cgroup is
+// still readable until it is reaped; a pid is not reused that soon.
+func (a *accounting) attribute(uuid string, procs []nvidia.AccountedProcess, usages map[containerKey]*finishedUsage, now time.Time) {
+	from := now.Add(-a.interval)
+	for _, proc := range procs {
+		if now.Sub(proc.End) > a.retain {
+			continue
+		}
+		key := finishedKey{uuid: uuid, pid: proc.Pid, start: proc.Start}
+		if _, ok := a.reported[key]; ok {
+			continue
+		}
+		a.reported[key] = now
+		owner, ok := a.owners[proc.Pid]
+		if !ok || owner.seen.Before(proc.Start) || owner.seen.After(proc.End) {
+			if proc.End.Before(from) {
+				continue
+			}
+			if owner, ok = a.lookup(proc.Pid); !ok {
+				continue
+			}
+		} else {
+			// the record is out, a later process may get the pid
+			delete(a.owners, proc.Pid)
+		}
+		container := containerKey{namespace: owner.namespace, pod: owner.pod, container: owner.container}
+		usage, ok := usages[container]
+		if !ok {
+			usage = new(finishedUsage)
+			usages[container] = usage
+		}
+		usage.count++
+		start, end := proc.Start, proc.End
+		if start.Before(from) {
+			start = from
+		}
+		if end.After(now) {
+			end = now
+		}
+		if end.After(start) {
+			usage.core += proc.SM * float64(end.Sub(start)) / float64(a.interval)
+		}
+		if float64(proc.MaxMem) > usage.maxMem {
+			usage.maxMem = float64(proc.MaxMem)
+		}
+	}
+}
+
+func (a *accounting) prune(now time.Time) {
+	for pid, owner := range a.owners {
+		if now.Sub(owner.seen) > a.retain {
+			delete(a.owners, pid)
+		}
+	}
+	for key, reported := range a.reported {
+		if now.Sub(reported) > a.retain {
+			delete(a.reported, key)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package exporter
 
 import (
 	v1 "k8s.io/api/core/v1"
+	"nano-gpu-exporter/pkg/util"
 	"sync"
 )
 
@@ -19,12 +20,19 @@ type containerCache struct {
 
 }
 
+// AddContainer caches the names of the containers of pod by their IDs without the
+// runtime prefix.
 func (c *containerCache) AddContainer(pod *v1.Pod){
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	if c.cache[string(pod.UID)] == nil {
 		c.cache[string(pod.UID)] = make(map[string]string)
 	}
 	for _, container := range pod.Status.ContainerStatuses{
-		c.cache[string(pod.UID)][container.ContainerID] = container.Name
+		if container.ContainerID == "" {
+			continue
+		}
+		c.cache[string(pod.UID)][util.NormalizeContainerID(container.ContainerID)] = container.Name
 	}
 }
 
@@ -37,7 +45,7 @@ func (c *containerCache) DelContainer(UID string){
 func (c *containerCache) GetContainerName(UID string, containerID string) (string, bool) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	containerName, exist := c.cache[UID][containerID]
+	containerName, exist := c.cache[UID][util.NormalizeContainerID(containerID)]
 	return containerName, exist
 }
 
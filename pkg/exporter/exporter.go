@@ -1,7 +1,6 @@
 package exporter
 
 import (
-	"fmt"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/klog"
 	"nano-gpu-exporter/pkg/kubepods"
@@ -10,15 +9,62 @@ import (
 	tree "nano-gpu-exporter/pkg/ptree"
 	"nano-gpu-exporter/pkg/util"
 	"strconv"
+	"sync"
 	"time"
-	//"github.com/alex337/go-nvml"
-	"tkestack.io/nvml"
 )
 
 const (
 	HundredCore = 100
 	GiBToMiB    = 1024
 )
+
+// connectRetry is the first wait before trying to reach the API server again.
+const connectRetry = time.Second
+
+// Options tunes how the exporter collects from the cards.
+type Options struct {
+	// Workers bounds how many cards are sampled at the same time.
+	Workers int
+	// CardTimeout bounds how long sampling one card may take, 0 means no limit.
+	CardTimeout time.Duration
+	// MetricGroups are the telemetry groups exported per card.
+	MetricGroups nvidia.Groups
+	// Health exports the health of the cards when set.
+	Health *nvidia.HealthMonitor
+	// Accounting turns on accounting mode to catch processes which finish between
+	// two cycles.
+	Accounting bool
+	// Scanner finds the processes of the pods.
+	Scanner tree.Scanner
+	// FS is the filesystem ProcRoot and SysRoot are read from, the one of the
+	// operating system when nil.
+	FS tree.FS
+	// ProcRoot is the host procfs, read for the processes outside the tracked pods.
+	ProcRoot string
+	// Unrequested maps the processes outside the tracked pods back to their pods
+	// and flags the pods using a card without requesting any gpu resource.
+	Unrequested bool
+	// UnrequestedEvents records an event on every pod flagged by Unrequested.
+	UnrequestedEvents bool
+	// Assignment exports the cards every container was given, read from its
+	// environment and, on cgroup v1, its device cgroup under SysRoot.
+	Assignment bool
+	SysRoot    string
+	// Allocations tell the devices the device plugins gave every container, they
+	// take precedence over Assignment when set.
+	Allocations kubepods.AllocationSource
+	// Kubernetes turns on watching the pods through Kube. The cards are exported
+	// while it is off or the API server cannot be reached.
+	Kubernetes bool
+	Kube       kubepods.ClientConfig
+}
+
+// cardIdentity is what the series of a card were last exported with.
+type cardIdentity struct {
+	labels metrics.CardLabels
+	info   metrics.CardInfo
+}
+
 type Exporter struct {
 	node       string
 	gpuLabels  []string
@@ -27,26 +73,127 @@ type Exporter struct {
 	contCache  ContainerCache
 	ptree      tree.PTree
 	collector  *metrics.Collector
-    device     *nvidia.DeviceImpl
+	device     nvidia.Device
+	sampler    *Sampler
+	reinits    uint64
+	cards      map[int]cardIdentity
+	// system is the driver info read last.
+	system     nvidia.SystemInfo
+	groups     nvidia.Groups
+	health     *nvidia.HealthMonitor
+	throttled  seriesSet
+	migs       seriesSet
+	podMIGs    seriesSet
+	accounting *accounting
+	finished   seriesSet
+	fs         tree.FS
+	procRoot   string
+	unattrib   seriesSet
+	// watcher is nil until the API server was reached, mu guards it.
+	mu         sync.Mutex
 	watcher    kubepods.Watcher
+	newWatcher func() (kubepods.Watcher, error)
+	after      func(time.Duration) <-chan time.Time
+	handler    *kubepods.Handler
+	kubernetes bool
+	kube       kubepods.ClientConfig
+	// unrequested is nil unless the pods using cards they did not request are
+	// flagged, flagged holds the UIDs of those pods.
+	unrequested seriesSet
+	events      bool
+	flagged     map[string]struct{}
+	labelSet    map[string]struct{}
+	// assignments caches the cards of every running container by ID, it is nil
+	// unless the assignments are exported.
+	assignments map[string]*tree.Assignment
+	assigned    seriesSet
+	sysRoot     string
+	allocations kubepods.AllocationSource
+	devices     seriesSet
+}
+
+// runningContainer is a tracked container and one of its processes.
+type runningContainer struct {
+	containerKey
+	pid int
+}
+
+// podUsage is what the processes of a pod used in a cycle: the cards, and the usage
+// of every MIG device.
+type podUsage struct {
+	namespace string
+	cards     map[int]struct{}
+	migs      map[migSlice]*tree.CardUsage
+}
+
+// migSlice is a MIG device of card.
+type migSlice struct {
+	card  int
+	slice tree.MIGSlice
 }
 
-func NewExporter(node string, gpuLabels []string, interval time.Duration) *Exporter {
+func NewExporter(node string, gpuLabels []string, interval time.Duration, device nvidia.Device, opts Options) *Exporter {
 	collector := metrics.NewCollector()
 	collector.Register()
-	ptree := tree.NewPTree(interval)
+	ptree := tree.NewPTree(interval, opts.Scanner)
 	podCache := NewCache()
 	contCache := NewContCache()
-	return &Exporter{
-		node:      node,
-		gpuLabels: gpuLabels,
-		interval:  interval,
-		podCache:  podCache,
-		contCache: contCache,
-		ptree:     ptree,
-		collector: collector,
-
-		watcher: kubepods.NewWatcher(&kubepods.Handler{
+	var account *accounting
+	if opts.Accounting {
+		account = newAccounting(interval, nil)
+	}
+	var unrequested seriesSet
+	if opts.Unrequested {
+		unrequested = make(seriesSet)
+	}
+	var assignments map[string]*tree.Assignment
+	if opts.Assignment {
+		assignments = make(map[string]*tree.Assignment)
+	}
+	fs := opts.FS
+	if fs == nil {
+		fs = tree.NewOSFS()
+	}
+	labelSet := make(map[string]struct{})
+	for _, label := range gpuLabels {
+		labelSet[label] = struct{}{}
+	}
+	e := &Exporter{
+		node:       node,
+		gpuLabels:  gpuLabels,
+		interval:   interval,
+		podCache:   podCache,
+		contCache:  contCache,
+		ptree:      ptree,
+		collector:  collector,
+		device:     device,
+		sampler:    NewSampler(device, opts.Workers, opts.CardTimeout, opts.MetricGroups, opts.Accounting),
+		cards:      make(map[int]cardIdentity),
+		groups:     opts.MetricGroups,
+		health:     opts.Health,
+		throttled:  make(seriesSet),
+		migs:       make(seriesSet),
+		podMIGs:    make(seriesSet),
+		accounting: account,
+		finished:   make(seriesSet),
+		fs:         fs,
+		procRoot:   opts.ProcRoot,
+		unattrib:   make(seriesSet),
+
+		unrequested: unrequested,
+		events:      opts.UnrequestedEvents,
+		flagged:     make(map[string]struct{}),
+		labelSet:    labelSet,
+		assignments: assignments,
+		assigned:    make(seriesSet),
+		sysRoot:     opts.SysRoot,
+		allocations: opts.Allocations,
+		devices:     make(seriesSet),
+
+		kubernetes: opts.Kubernetes,
+		kube:       opts.Kube,
+		after:      time.After,
+		handler: &kubepods.Handler{
 			AddFunc: func(pod *v1.Pod) {
 				podCache.AddPod(string(pod.UID), pod)
 				ptree.InterestPod(string(pod.UID), util.QoS(pod))
@@ -79,65 +226,97 @@ func NewExporter(node string, gpuLabels []string, interval time.Duration) *Expor
 				return
 			},
 
-		}, gpuLabels, node),
+		},
+	}
+	e.newWatcher = func() (kubepods.Watcher, error) {
+		return kubepods.NewWatcher(e.handler, e.gpuLabels, e.node, e.kube)
+	}
+	if account != nil {
+		account.lookup = e.processOwner
 	}
+	return e
 }
 
 func (e *Exporter) Once() {
-	nvml.Init()
-	defer nvml.Shutdown()
-	cardCount, err := nvml.DeviceGetCount()
+	cardCount, err := e.device.GetDeviceCount()
 
 	klog.Info("Exporter run")
 	if err != nil{
-		klog.Error("Cannot get DeviceGetCount by nvml")
+		klog.Error("Cannot get device count: ", err)
 	}
+	samples := e.sampler.Sample(cardCount)
 	cardUsages := make([]tree.CardUsage, cardCount)
 	processUsages := make([]map[int]*tree.ProcessUsage, cardCount)
-	for i := 0; i < int(cardCount); i++ {
-		processUsages[i], err = e.device.GetDeviceUsage(i)
-		if err != nil{
-			klog.Errorf("Cannot get processusage in GPU %d", i)
-		}
-	}
 	var totalMem, GPUMem uint64
-	for i := 0; i < int(cardCount); i++ {
-		dev, err := nvml.DeviceGetHandleByIndex(uint(i))
-		if err != nil{
-			klog.Error("DeviceGetHandleByIndex", err)
+	for i, sample := range samples {
+		processUsages[i] = sample.Usage
+		totalMem += sample.MemTotal
+		if sample.MemTotal != 0 {
+			GPUMem = sample.MemTotal
 		}
-		_, _, memTotal, err := dev.DeviceGetMemoryInfo()
-		totalMem += memTotal >> 20
-		GPUMem = memTotal >> 20
 	}
+	podUsages := make(map[string]podUsage)
 	node := e.ptree.Snapshot()
+	scanned := e.ptree.LastUpdate()
+	attributed := make(map[int]struct{})
+	running := make(map[string]runningContainer)
 	for _, pod := range node.Pods{
 		p, _ := e.podCache.GetPod(pod.UID)
 		if containerMap, exist := e.contCache.GetContainer(pod.UID); !exist || containerMap == nil{
 			e.contCache.AddContainer(p)
 		}
 		ns := p.Namespace
+		used := podUsage{namespace: ns, cards: make(map[int]struct{}), migs: make(map[migSlice]*tree.CardUsage)}
+		podUsages[pod.UID] = used
 		var podCore, podMem, podCoreRequest, podMemRequest float64
+		var podEngines tree.CardUsage
+		podMemContext := make(map[string]float64)
 		for _, container := range pod.Containers{
-			contName, exist := e.contCache.GetContainerName(pod.UID, fmt.Sprintf(util.ContainerID, container.ID))
+			contName, exist := e.contCache.GetContainerName(pod.UID, container.ID)
 			if !exist {
 				continue
 			}
+			for pid := range container.Processes {
+				running[container.ID] = runningContainer{containerKey: containerKey{namespace: ns, pod: pod.UID, container: contName}, pid: pid}
+				break
+			}
 			var contCore, contMem float64
+			var contEngines tree.CardUsage
+			contMemContext := make(map[string]float64)
 			for _, proc := range container.Processes{
+				if e.accounting != nil {
+					e.accounting.observe(proc.Pid, pidOwner{namespace: ns, pod: pod.UID, container: contName, seen: scanned})
+				}
 				for i := 0; i < int(cardCount); i++ {
 					procUsage, exist := processUsages[i][proc.Pid]
 					if exist {
 						contMem  += procUsage.GPUMem
 						contCore += procUsage.GPUCore
-						klog.Info("contCore:",contCore)
-						cardUsages[i].Mem  += procUsage.GPUMem
-						cardUsages[i].Core += procUsage.GPUCore
+						if procUsage.Context != "" {
+							contMemContext[procUsage.Context] += procUsage.GPUMem
+							podMemContext[procUsage.Context] += procUsage.GPUMem
+						}
+						klog.V(4).Infof("GPU %d used by pid %d of container %s, container core %.2f", i, proc.Pid, contName, contCore)
+						used.cards[i] = struct{}{}
+						attributed[proc.Pid] = struct{}{}
+						if procUsage.MIG != nil {
+							key := migSlice{card: i, slice: *procUsage.MIG}
+							if _, ok := used.migs[key]; !ok {
+								used.migs[key] = new(tree.CardUsage)
+							}
+							used.migs[key].Mem += procUsage.GPUMem
+							used.migs[key].Core += procUsage.GPUCore
+						}
+						contEngines.Add(procUsage)
+						cardUsages[i].Add(procUsage)
 					}
 				}
 			}
 			podCore += contCore
 			podMem += contMem
+			podEngines.Enc += contEngines.Enc
+			podEngines.Dec += contEngines.Dec
+			podEngines.MemBandwidth += contEngines.MemBandwidth
 			var memRequest, coreRequest float64
 			for _,cont := range p.Spec.Containers{
 				if contName == cont.Name {
@@ -162,6 +341,8 @@ func (e *Exporter) Once() {
 				contMemUtil = contMem / memRequest
 			}
 			e.collector.Container(e.node, ns, pod.UID, contName, contCore, contMem, util.Decimal(contCoreUtil * 100), util.Decimal(contMemUtil * 100))
+			e.collector.ContainerContext(e.node, ns, pod.UID, contName, contMemContext)
+			e.collector.ContainerEngines(e.node, ns, pod.UID, contName, contEngines)
 		}
 		//podMem, podCore, podMemRequest, podCoreRequest := e.displayContUtil(pod, p, ns, cardCount, processUsages, cardUsages, GPUMem)
 
@@ -174,30 +355,601 @@ func (e *Exporter) Once() {
 		}
 
 		e.collector.Pod(e.node, ns, pod.UID, podCore, podMem, util.Decimal(podCoreUtil * 100), util.Decimal(podMemUtil * 100), podMemRequest, util.Decimal(podCore / float64(cardCount * HundredCore) * 100), util.Decimal(podMem / float64(totalMem) * 100))
+		e.collector.PodContext(e.node, ns, pod.UID, podMemContext)
+		e.collector.PodEngines(e.node, ns, pod.UID, podEngines)
+	}
+	e.displayGPUUtil(samples, cardUsages)
+	e.displayPodThrottle(samples, podUsages)
+	e.displayMIG(samples, podUsages)
+	e.displayFinished(samples)
+	e.displayUnattributed(samples, attributed)
+	e.displayUnrequested(samples, attributed)
+	e.displayAssigned(samples, running)
+	e.displayReinit()
+}
+
+// displayPodThrottle marks the pods whose cards were slowed down during the cycle,
+// and drops the series of pods and reasons which no longer apply.
+func (e *Exporter) displayPodThrottle(samples []CardSample, podUsages map[string]podUsage) {
+	throttled := make(seriesSet)
+	for uid, used := range podUsages {
+		for i := range used.cards {
+			card, ok := e.cards[i]
+			if !ok || i >= len(samples) {
+				continue
+			}
+			for reason, active := range samples[i].Throttle {
+				if _, slowdown := nvidia.SlowdownReasons[reason]; !active || !slowdown {
+					continue
+				}
+				throttled.add(e.collector.PodThrottled(e.node, used.namespace, uid, card.labels, reason))
+			}
+		}
+	}
+	e.throttled.sweep(throttled, e.collector.DeletePodThrottled)
+	e.throttled = throttled
+}
+
+// displayMIG exports the usage of the MIG devices and of the pods running in them,
+// dropping the series of devices and pods which are gone.
+func (e *Exporter) displayMIG(samples []CardSample, podUsages map[string]podUsage) {
+	migs, podMIGs := make(seriesSet), make(seriesSet)
+	profiles := make(map[migSlice]metrics.MIGLabels)
+	sampled := make(map[migSlice]bool)
+	for i, sample := range samples {
+		card, ok := e.cards[i]
+		if !ok || len(sample.MIG) == 0 {
+			continue
+		}
+		core := make(map[tree.MIGSlice]float64)
+		for _, usage := range sample.Usage {
+			if usage.MIG != nil {
+				core[*usage.MIG] += usage.GPUCore
+			}
+		}
+		for _, mig := range sample.MIG {
+			labels := metrics.MIGLabels{
+				GPUInstance:     strconv.Itoa(mig.Slice.GPUInstance),
+				ComputeInstance: strconv.Itoa(mig.Slice.ComputeInstance),
+				Profile:         mig.Profile,
+			}
+			key := migSlice{card: i, slice: mig.Slice}
+			profiles[key], sampled[key] = labels, mig.CoreSampled
+			var migCore *float64
+			if mig.CoreSampled {
+				value := core[mig.Slice]
+				migCore = &value
+			}
+			migs.add(e.collector.MIG(e.node, card.labels, labels, migCore, float64(mig.MemoryUsed), float64(mig.MemoryTotal)))
+		}
+	}
+	for uid, used := range podUsages {
+		for key, usage := range used.migs {
+			labels, ok := profiles[key]
+			if !ok {
+				continue
+			}
+			var podCore *float64
+			if sampled[key] {
+				podCore = &usage.Core
+			}
+			podMIGs.add(e.collector.PodMIG(e.node, used.namespace, uid, e.cards[key.card].labels, labels, podCore, usage.Mem))
+		}
+	}
+	e.migs.sweep(migs, e.collector.DeleteMIG)
+	e.podMIGs.sweep(podMIGs, e.collector.DeletePodMIG)
+	e.migs, e.podMIGs = migs, podMIGs
+}
+
+// displayUnattributed exports the usage of the processes on every card which are
+// not in any tracked pod: host processes, system daemons and pods left out by the
+// label filter. At verbosity 4 every such process gets its own series.
+func (e *Exporter) displayUnattributed(samples []CardSample, attributed map[int]struct{}) {
+	perProcess := bool(klog.V(4))
+	unattrib := make(seriesSet)
+	for i, sample := range samples {
+		card, ok := e.cards[i]
+		if !ok {
+			continue
+		}
+		if sample.Usage == nil {
+			// the processes of the card could not be read, its last values are stale
+			e.collector.DeleteUnattributed(e.node, card.labels)
+			continue
+		}
+		var core, mem float64
+		for pid, usage := range sample.Usage {
+			if _, ok := attributed[pid]; ok {
+				continue
+			}
+			core += usage.GPUCore
+			mem += usage.GPUMem
+			if perProcess {
+				command, cgroup := tree.ProcessInfo(e.fs, e.procRoot, pid)
+				klog.Infof("GPU %d used by pid %d (%s) outside the tracked pods, cgroup %s, core %.2f, mem %.0f", i, pid, command, cgroup, usage.GPUCore, usage.GPUMem)
+				unattrib.add(e.collector.UnattributedProcess(e.node, card.labels, pid, command, cgroup, usage.GPUCore, usage.GPUMem))
+			}
+		}
+		e.collector.Unattributed(e.node, card.labels, core, mem)
+	}
+	e.unattrib.sweep(unattrib, e.collector.DeleteUnattributedProcess)
+	e.unattrib = unattrib
+}
+
+// displayUnrequested finds the pods of the processes outside the tracked pods and
+// exports the usage of those which requested no gpu resource, e.g. pods mounting
+// the devices or setting NVIDIA_VISIBLE_DEVICES=all. A pod gets one event when it
+// starts using a card.
+func (e *Exporter) displayUnrequested(samples []CardSample, attributed map[int]struct{}) {
+	if e.unrequested == nil {
+		return
+	}
+	pods := make(map[string]*v1.Pod)
+	usages := make(map[string]map[int]*tree.CardUsage)
+	for i, sample := range samples {
+		if _, ok := e.cards[i]; !ok {
+			continue
+		}
+		for pid, usage := range sample.Usage {
+			if _, ok := attributed[pid]; ok {
+				continue
+			}
+			UID, _, err := tree.PodOfProcess(e.fs, e.procRoot, pid)
+			if err != nil || UID == "" {
+				continue
+			}
+			pod, seen := pods[UID]
+			if !seen {
+				// pods requesting gpus are left to the tracked pods, they may just
+				// not be scanned yet
+				if watcher := e.kubeWatcher(); watcher != nil {
+					pod, _ = watcher.GetPodByUID(UID)
+				}
+				if pod != nil && util.PodHasResource(pod, e.labelSet) {
+					pod = nil
+				}
+				pods[UID] = pod
+			}
+			if pod == nil {
+				continue
+			}
+			if usages[UID] == nil {
+				usages[UID] = make(map[int]*tree.CardUsage)
+			}
+			if usages[UID][i] == nil {
+				usages[UID][i] = new(tree.CardUsage)
+			}
+			usages[UID][i].Add(usage)
+		}
+	}
+	unrequested := make(seriesSet)
+	flagged := make(map[string]struct{})
+	for UID, cards := range usages {
+		pod := pods[UID]
+		for i, usage := range cards {
+			card := e.cards[i]
+			unrequested.add(e.collector.PodUnrequested(e.node, pod.Namespace, UID, pod.Name, card.labels, usage.Core, usage.Mem))
+		}
+		flagged[UID] = struct{}{}
+		if _, ok := e.flagged[UID]; ok {
+			continue
+		}
+		klog.Warningf("Pod %s/%s uses %d GPU(s) without requesting any", pod.Namespace, pod.Name, len(cards))
+		if e.events {
+			e.kubeWatcher().Eventf(pod, v1.EventTypeWarning, "UnrequestedGPU", "Pod uses %d gpu card(s) without requesting any gpu resource", len(cards))
+		}
 	}
-	e.displayGPUUtil(cardCount, cardUsages)
+	e.unrequested.sweep(unrequested, e.collector.DeletePodUnrequested)
+	e.unrequested, e.flagged = unrequested, flagged
 }
 
-func (e *Exporter) displayGPUUtil(cardCount uint, cardUsages []tree.CardUsage){
-	for i := 0; i < int(cardCount); i++ {
-		dev, err := nvml.DeviceGetHandleByIndex(uint(i))
-		_, memUsed, memTotal, err := dev.DeviceGetMemoryInfo()
-		//util1, _ := dev.DeviceGetAverageGPUUsage(time.Second)
-		utilization, err := dev.DeviceGetUtilizationRates()
+// displayAssigned exports the cards every running container was given, even those
+// it holds no context on. They come from the device allocations when there is a
+// source for them, else from the environment and device cgroup of the container,
+// read once per container.
+func (e *Exporter) displayAssigned(samples []CardSample, running map[string]runningContainer) {
+	if e.assignments == nil && e.allocations == nil {
+		return
+	}
+	uuids := make(map[string]int)
+	byMinor := make(map[int]int)
+	for i, sample := range samples {
+		if _, ok := e.cards[i]; !ok || sample.Info == nil {
+			continue
+		}
+		uuids[sample.Info.UUID] = i
+		for _, mig := range sample.MIG {
+			uuids[mig.UUID] = i
+		}
+		byMinor[sample.Info.Minor] = i
+	}
+	assigned := make(seriesSet)
+	if allocated, ok := e.allocatedCards(uuids); ok {
+		for key, cards := range allocated {
+			for i := range cards {
+				assigned.add(e.collector.ContainerAssigned(e.node, key.namespace, key.pod, key.container, e.cards[i].labels))
+			}
+		}
+	} else if e.assignments != nil {
+		e.inferAssigned(running, uuids, byMinor, assigned)
+	}
+	e.assigned.sweep(assigned, e.collector.DeleteContainerAssigned)
+	e.assigned = assigned
+}
+
+// inferAssigned adds the cards of the running containers read from their
+// environment and device cgroup to assigned.
+func (e *Exporter) inferAssigned(running map[string]runningContainer, uuids map[string]int, byMinor map[int]int, assigned seriesSet) {
+	byDevice := make(map[string]int)
+	for uuid, i := range uuids {
+		byDevice[uuid] = i
+		byDevice[strconv.Itoa(i)] = i
+	}
+	assignments := make(map[string]*tree.Assignment)
+	for ID, container := range running {
+		assignment, ok := e.assignments[ID]
+		if !ok {
+			var err error
+			assignment, err = tree.ResolveAssignment(e.fs, e.procRoot, e.sysRoot, container.pid)
+			if err != nil {
+				klog.V(4).Infof("Cannot read the gpus of container %s: %v", ID, err)
+				continue
+			}
+		}
+		assignments[ID] = assignment
+		for i := range assignedCards(assignment, byDevice, byMinor) {
+			assigned.add(e.collector.ContainerAssigned(e.node, container.namespace, container.pod, container.container, e.cards[i].labels))
+		}
+	}
+	e.assignments = assignments
+}
+
+// allocatedCards maps the devices of the gpu resources given to the tracked
+// containers to cards, and exports how many devices of every card are allocated. It
+// is false when there is no allocation source or it failed.
+func (e *Exporter) allocatedCards(uuids map[string]int) (map[containerKey]map[int]struct{}, bool) {
+	if e.allocations == nil {
+		return nil, false
+	}
+	allocations, err := e.allocations.Allocations()
+	if err != nil {
+		klog.Errorf("Cannot read the device allocations: %v", err)
+		return nil, false
+	}
+	type resourceCard struct {
+		resource string
+		card     int
+	}
+	allocatable := make(map[resourceCard]float64)
+	allocated := make(map[resourceCard]float64)
+	for resource, IDs := range allocations.Allocatable {
+		if _, ok := e.labelSet[resource]; !ok {
+			continue
+		}
+		for _, ID := range IDs {
+			if i, ok := kubepods.DeviceCard(ID, uuids); ok {
+				key := resourceCard{resource: resource, card: i}
+				allocatable[key]++
+				// cards none of whose devices is given out export 0
+				allocated[key] = 0
+			}
+		}
+	}
+	cards := make(map[containerKey]map[int]struct{})
+	for _, devices := range allocations.Containers {
+		if _, ok := e.labelSet[devices.Resource]; !ok {
+			continue
+		}
+		for _, ID := range devices.DeviceIDs {
+			i, ok := kubepods.DeviceCard(ID, uuids)
+			if !ok {
+				continue
+			}
+			allocated[resourceCard{resource: devices.Resource, card: i}]++
+			key, ok := e.trackedContainer(devices)
+			if !ok {
+				continue
+			}
+			if cards[key] == nil {
+				cards[key] = make(map[int]struct{})
+			}
+			cards[key][i] = struct{}{}
+		}
+	}
+	series := make(seriesSet)
+	for key, count := range allocatable {
+		series.add(e.collector.DevicesAllocatable(e.node, e.cards[key.card].labels, key.resource, count))
+	}
+	for key, count := range allocated {
+		series.add(e.collector.DevicesAllocated(e.node, e.cards[key.card].labels, key.resource, count))
+	}
+	e.devices.sweep(series, e.collector.DeleteDevices)
+	e.devices = series
+	return cards, true
+}
+
+// trackedContainer returns the key of the container the devices were given to,
+// false when its pod is not tracked.
+func (e *Exporter) trackedContainer(devices kubepods.ContainerDevices) (containerKey, bool) {
+	UID := devices.PodUID
+	if UID == "" {
+		watcher := e.kubeWatcher()
+		if watcher == nil {
+			return containerKey{}, false
+		}
+		pod, err := watcher.GetPod(devices.Namespace, devices.Pod)
 		if err != nil {
-			klog.Error("DeviceGetMemoryInfo", err)
+			return containerKey{}, false
+		}
+		UID = string(pod.UID)
+	}
+	pod, ok := e.podCache.GetPod(UID)
+	if !ok {
+		return containerKey{}, false
+	}
+	return containerKey{namespace: pod.Namespace, pod: UID, container: devices.Container}, true
+}
+
+// assignedCards maps an assignment to the indexes of the cards, the device cgroup
+// wins over the environment when it restricts the cards.
+func assignedCards(assignment *tree.Assignment, byDevice map[string]int, byMinor map[int]int) map[int]struct{} {
+	cards := make(map[int]struct{})
+	switch {
+	case assignment.Restricted:
+		for _, minor := range assignment.Minors {
+			if i, ok := byMinor[minor]; ok {
+				cards[i] = struct{}{}
+			}
+		}
+	case assignment.All:
+		for _, i := range byMinor {
+			cards[i] = struct{}{}
 		}
+	default:
+		for _, device := range assignment.Devices {
+			if i, ok := byDevice[device]; ok {
+				cards[i] = struct{}{}
+			}
+		}
+	}
+	return cards
+}
+
+// displayFinished exports what the processes which finished during the cycle used
+// per container, when accounting mode is on.
+func (e *Exporter) displayFinished(samples []CardSample) {
+	if e.accounting == nil {
+		return
+	}
+	now := e.accounting.clock()
+	running := make(map[int]struct{})
+	for _, sample := range samples {
+		for pid := range sample.Usage {
+			running[pid] = struct{}{}
+		}
+	}
+	e.accounting.resolve(running, now)
+	usages := make(map[containerKey]*finishedUsage)
+	for i, sample := range samples {
+		card, ok := e.cards[i]
+		if !ok {
+			continue
+		}
+		e.accounting.attribute(card.labels.UUID, sample.Finished, usages, now)
+	}
+	finished := make(seriesSet)
+	for key, usage := range usages {
+		finished.add(e.collector.ContainerFinished(e.node, key.namespace, key.pod, key.container, usage.count, usage.core, usage.maxMem))
+	}
+	e.finished.sweep(finished, e.collector.DeleteContainerFinished)
+	e.finished = finished
+	e.accounting.prune(now)
+}
+
+// processOwner finds the container of a pid through its cgroup, for the processes
+// the process tree did not see.
+func (e *Exporter) processOwner(pid int) (pidOwner, bool) {
+	UID, containerID, err := tree.PodOfProcess(e.fs, e.procRoot, pid)
+	if err != nil || UID == "" || containerID == "" {
+		return pidOwner{}, false
+	}
+	pod, ok := e.podCache.GetPod(UID)
+	if !ok || pod == nil {
+		return pidOwner{}, false
+	}
+	name, ok := e.contCache.GetContainerName(UID, containerID)
+	if !ok {
+		// the container started after the names of the pod were cached
+		e.contCache.AddContainer(pod)
+		if name, ok = e.contCache.GetContainerName(UID, containerID); !ok {
+			return pidOwner{}, false
+		}
+	}
+	return pidOwner{namespace: pod.Namespace, pod: UID, container: name}, true
+}
+
+// enableAccounting turns on accounting mode on every card, and gives up on it when
+// the backend does not support it.
+func (e *Exporter) enableAccounting() {
+	count, err := e.device.GetDeviceCount()
+	if err != nil {
+		klog.Errorf("Cannot enable accounting mode: %v", err)
+		return
+	}
+	for i := 0; i < count; i++ {
+		err := e.device.EnableAccounting(i)
+		if err == nvidia.ErrAccountingUnsupported {
+			klog.Warningf("Accounting mode is off: %v", err)
+			e.accounting = nil
+			e.sampler.accounting = false
+			return
+		}
+		if err != nil {
+			klog.Errorf("Cannot enable accounting mode of GPU %d: %v", i, err)
+		}
+	}
+}
+
+func (e *Exporter) displayReinit() {
+	reinits, last := e.device.Reinits()
+	if reinits > e.reinits {
+		e.collector.Reinit(float64(reinits - e.reinits), last)
+		e.reinits = reinits
+	}
+}
+
+func (e *Exporter) displayGPUUtil(samples []CardSample, cardUsages []tree.CardUsage){
+	system, err := e.device.GetSystemInfo()
+	if err != nil {
+		klog.Error("Cannot get gpu driver info: ", err)
+		// the versions read last still hold, they only change when the driver does
+		system = &e.system
+	} else {
+		e.system = *system
+	}
+	for i, sample := range samples {
+		if sample.MemTotal == 0 {
+			continue
+		}
+		memUsed, memTotal, coreUtil := sample.MemUsed, sample.MemTotal, sample.CoreUtil
 		klog.Info("cardUsagesMem:", cardUsages[i].Mem)
 		klog.Info("cardUsagesCore:", cardUsages[i].Core)
 
+		card := e.cardIdentity(i, sample, system)
 		if cardUsages[i].Mem >= 0 || cardUsages[i].Core >= 0 {
-			e.collector.Card(e.node, strconv.Itoa(i), cardUsages[i].Core, float64(memUsed >> 20), util.Decimal(float64(utilization.GPU)), util.Decimal(float64(memUsed >> 20) / float64(memTotal >> 20) * 100))
+			e.collector.Card(e.node, card.labels, cardUsages[i].Core, float64(memUsed), util.Decimal(float64(coreUtil)), util.Decimal(float64(memUsed) / float64(memTotal) * 100))
+		}
+		e.collector.CardEngines(e.node, card.labels, cardUsages[i])
+		e.collector.CardInfo(e.node, card.labels, card.info)
+		if sample.Telemetry != nil {
+			e.collector.Telemetry(e.node, card.labels, sample.Telemetry)
+		}
+		if e.groups.Has(nvidia.GroupMemUtil) {
+			e.collector.MemControllerUtil(e.node, card.labels, float64(sample.MemUtil))
+		}
+		if sample.Throttle != nil {
+			e.collector.Throttle(e.node, card.labels, sample.Throttle)
+		}
+		if e.health != nil {
+			if health, ok := e.health.Health(card.labels.UUID); ok {
+				e.collector.Health(e.node, card.labels, health)
+			}
+		}
+	}
+	for i, card := range e.cards {
+		if i >= len(samples) {
+			e.collector.DeleteCard(e.node, card.labels, card.info)
+			delete(e.cards, i)
 		}
 	}
 }
 
+// cardIdentity returns the labels of card i, dropping the series exported under
+// its previous identity when the index now belongs to another card. A card whose
+// info could not be read keeps its previous identity, a new driver only replaces
+// the info series of the card.
+func (e *Exporter) cardIdentity(i int, sample CardSample, system *nvidia.SystemInfo) cardIdentity {
+	if old, ok := e.cards[i]; ok && sample.Info == nil {
+		return old
+	}
+	card := cardIdentity{
+		labels: metrics.CardLabels{Index: strconv.Itoa(i)},
+		info: metrics.CardInfo{
+			Driver:      system.DriverVersion,
+			CUDA:        system.CUDAVersion,
+			MemoryTotal: sample.MemTotal,
+		},
+	}
+	if sample.Info != nil {
+		card.labels.UUID = sample.Info.UUID
+		card.labels.Model = sample.Info.Model
+		card.labels.PCIBusID = sample.Info.PCIBusID
+		card.info.VBIOS = sample.Info.VBIOS
+	}
+	if old, ok := e.cards[i]; ok {
+		if old.labels.Index != card.labels.Index || old.labels.UUID != card.labels.UUID || old.labels.Model != card.labels.Model {
+			e.collector.DeleteCard(e.node, old.labels, old.info)
+		} else if old.info != card.info {
+			e.collector.DeleteCardInfo(e.node, old.labels, old.info)
+		}
+	}
+	e.cards[i] = card
+	return card
+}
+
 func (e *Exporter) Run(stop <-chan struct{}) {
+	if e.accounting != nil {
+		e.enableAccounting()
+	}
 	go e.ptree.Run(stop)
-	e.watcher.Run(stop)
+	if e.kubernetes {
+		go e.connect(stop)
+	} else {
+		klog.Info("Kubernetes is off, exporting the cards only")
+		e.collector.KubernetesConnected(false)
+	}
 	util.Loop(e.Once, e.interval, stop)
+}
+
+// connect watches the pods once the API server answers, and then keeps telling
+// whether it still answers. While it does not, it tries again after connectRetry,
+// doubling the wait up to the interval. The informers of the watcher reconnect by
+// themselves.
+func (e *Exporter) connect(stop <-chan struct{}) {
+	var retry time.Duration
+	for {
+		wait := e.interval
+		if err := e.reconnect(stop); err != nil {
+			retry = backoff(retry, e.interval)
+			wait = retry
+		} else {
+			retry = 0
+		}
+		select {
+		case <-stop:
+			return
+		case <-e.after(wait):
+		}
+	}
+}
+
+// reconnect creates the watcher unless it exists, otherwise pings the API server.
+func (e *Exporter) reconnect(stop <-chan struct{}) error {
+	watcher := e.kubeWatcher()
+	var err error
+	if watcher == nil {
+		if watcher, err = e.newWatcher(); err == nil {
+			watcher.Run(stop)
+			e.mu.Lock()
+			e.watcher = watcher
+			e.mu.Unlock()
+			klog.Info("Connected to kubernetes")
+		} else {
+			klog.Warningf("Cannot reach kubernetes, exporting the cards only: %v", err)
+		}
+	} else if err = watcher.Ping(); err != nil {
+		klog.Warningf("Lost kubernetes: %v", err)
+	}
+	e.collector.KubernetesConnected(err == nil)
+	return err
+}
+
+// backoff returns the wait after a failed attempt, retry being the wait after the
+// previous one or 0 when it succeeded.
+func backoff(retry, max time.Duration) time.Duration {
+	if retry == 0 {
+		retry = connectRetry
+	} else {
+		retry *= 2
+	}
+	if retry > max {
+		return max
+	}
+	return retry
+}
+
+func (e *Exporter) kubeWatcher() kubepods.Watcher {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.watcher
 }
\ No newline at end of file
@@ -0,0 +1,468 @@
+package exporter
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"nano-gpu-exporter/pkg/kubepods"
+	"nano-gpu-exporter/pkg/nvidia"
+	tree "nano-gpu-exporter/pkg/ptree"
+)
+
+const (
+	testNode = "gpu-node"
+	testUID  = "17eb80b0-6085-4d12-8e79-553e799d2f0b"
+)
+
+var (
+	mainID   = strings.Repeat("a", 64)
+	workerID = strings.Repeat("b", 64)
+)
+
+// testClock is a clock the test moves by hand.
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	return c.now
+}
+
+func (c *testClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+// fakeTree serves the snapshot the test sets instead of scanning cgroups.
+type fakeTree struct {
+	node    *tree.Node
+	scanned time.Time
+}
+
+func (f *fakeTree) Run(stop <-chan struct{})    {}
+func (f *fakeTree) InterestPod(UID, QOS string) {}
+func (f *fakeTree) ForgetPod(UID string)        {}
+func (f *fakeTree) DeleteScanner(UID string)    {}
+func (f *fakeTree) Snapshot() *tree.Node        { return f.node }
+func (f *fakeTree) LastUpdate() time.Time       { return f.scanned }
+
+// set makes the snapshot hold the pod of the test with the pids of every container.
+func (f *fakeTree) set(scanned time.Time, pids map[string][]int) {
+	pod := tree.NewPod(tree.QOSBurstable, testUID)
+	for id, list := range pids {
+		container := pod.AddContainer(id)
+		for _, pid := range list {
+			container.AddProcess(pid)
+		}
+	}
+	f.node = tree.NewNode()
+	f.node.Pods[testUID] = pod
+	f.scanned = scanned
+}
+
+// testPod runs the containers main and worker.
+func testPod() *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ml", Name: "trainer", UID: types.UID(testUID)},
+		Status: v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{
+			{Name: "main", ContainerID: "containerd://" + mainID},
+			{Name: "worker", ContainerID: "containerd://" + workerID},
+		}},
+	}
+}
+
+// writeProc writes the cgroup file of every pid under a temporary procfs.
+func writeProc(t *testing.T, cgroups map[int]string) string {
+	t.Helper()
+	root, err := ioutil.TempDir("", "proc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(root) })
+	for pid, cgroup := range cgroups {
+		dir := filepath.Join(root, strconv.Itoa(pid))
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, "cgroup"), []byte(cgroup), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+// newTestExporter returns an exporter of device whose metrics are registered to
+// its own registry, with a process tree the test sets.
+func newTestExporter(t *testing.T, device nvidia.Device, interval time.Duration, opts Options) (*Exporter, *fakeTree) {
+	t.Helper()
+	registerer := prometheus.DefaultRegisterer
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+	defer func() { prometheus.DefaultRegisterer = registerer }()
+	e := NewExporter(testNode, []string{"nvidia.com/gpu"}, interval, device, opts)
+	ptree := &fakeTree{node: tree.NewNode()}
+	e.ptree = ptree
+	return e, ptree
+}
+
+// gauge returns the value of the series of vec whose labels hold want, false when
+// there is none.
+func gauge(t *testing.T, vec *prometheus.GaugeVec, want map[string]string) (float64, bool) {
+	t.Helper()
+	for _, metric := range collect(t, vec) {
+		labels := make(map[string]string)
+		for _, label := range metric.Label {
+			labels[label.GetName()] = label.GetValue()
+		}
+		matches := true
+		for name, value := range want {
+			if labels[name] != value {
+				matches = false
+			}
+		}
+		if matches {
+			return metric.GetGauge().GetValue(), true
+		}
+	}
+	return 0, false
+}
+
+func collect(t *testing.T, vec *prometheus.GaugeVec) []*dto.Metric {
+	t.Helper()
+	ch := make(chan prometheus.Metric)
+	go func() {
+		vec.Collect(ch)
+		close(ch)
+	}()
+	var metrics []*dto.Metric
+	for metric := range ch {
+		m := new(dto.Metric)
+		if err := metric.Write(m); err != nil {
+			t.Fatal(err)
+		}
+		metrics = append(metrics, m)
+	}
+	return metrics
+}
+
+func steps(d time.Duration, mem uint64, sm uint) []nvidia.SimStep {
+	return []nvidia.SimStep{{Duration: metav1.Duration{Duration: d}, Mem: mem, SM: sm}}
+}
+
+func TestFinishedProcessesAttribution(t *testing.T) {
+	const interval = 10 * time.Second
+	device := nvidia.NewSimulatedDevice(&nvidia.Scenario{Cards: []nvidia.SimCard{{
+		MemoryTotal: 15109,
+		Processes: []nvidia.SimProcess{
+			// seen by the process tree in main
+			{Pid: 100, Steps: steps(15*time.Second, 1024, 50)},
+			// running at the first cycle only, never seen by the process tree
+			{Pid: 200, Start: metav1.Duration{Duration: 12 * time.Second}, Steps: steps(5*time.Second, 512, 80)},
+			// a host process
+			{Pid: 300, Steps: steps(15*time.Second, 100, 10)},
+			// lives between two cycles, its cgroup is read before it is reaped
+			{Pid: 400, Start: metav1.Duration{Duration: 16 * time.Second}, Steps: steps(3*time.Second, 256, 60)},
+		},
+	}}})
+	clock := &testClock{now: time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)}
+	device.SetClock(clock.Now)
+	workerCgroup := "0::/kubepods/burstable/pod" + testUID + "/" + workerID + "\n"
+	proc := writeProc(t, map[int]string{
+		200: workerCgroup,
+		300: "0::/system.slice/xorg.service\n",
+		400: workerCgroup,
+	})
+	e, ptree := newTestExporter(t, device, interval, Options{Accounting: true, ProcRoot: proc})
+	e.accounting.clock = clock.Now
+	e.podCache.AddPod(testUID, testPod())
+	e.enableAccounting()
+
+	finished := func(container string) (float64, float64) {
+		labels := map[string]string{"namespace": "ml", "pod": testUID, "container": container}
+		count, _ := gauge(t, e.collector.ContainerFinishedProcs, labels)
+		mem, _ := gauge(t, e.collector.ContainerFinishedMem, labels)
+		return count, mem
+	}
+
+	clock.Advance(14 * time.Second)
+	ptree.set(clock.Now(), map[string][]int{mainID: {100}, workerID: {}})
+	e.Once()
+	if series := collect(t, e.collector.ContainerFinishedProcs); len(series) != 0 {
+		t.Errorf("finished processes reported while all of them run: %v", series)
+	}
+
+	clock.Advance(interval)
+	ptree.set(clock.Now(), map[string][]int{mainID: {}, workerID: {}})
+	e.Once()
+	if count, mem := finished("main"); count != 1 || mem != 1024 {
+		t.Errorf("finished in main = %v processes using %v MiB, want 1 using 1024", count, mem)
+	}
+	if count, mem := finished("worker"); count != 2 || mem != 512 {
+		t.Errorf("finished in worker = %v processes using %v MiB, want 2 using 512", count, mem)
+	}
+	if series := collect(t, e.collector.ContainerFinishedProcs); len(series) != 2 {
+		t.Errorf("finished processes of %d containers, want main and worker only", len(series))
+	}
+
+	// accounting mode still lists the processes, they are not counted again
+	clock.Advance(interval)
+	e.Once()
+	if series := collect(t, e.collector.ContainerFinishedProcs); len(series) != 0 {
+		t.Errorf("processes reported again in the next cycle: %v", series)
+	}
+}
+
+// flakyDevice is a simulated card whose driver info can be made to fail.
+type flakyDevice struct {
+	*nvidia.SimulatedDevice
+	systemErr error
+}
+
+func (d *flakyDevice) GetSystemInfo() (*nvidia.SystemInfo, error) {
+	if d.systemErr != nil {
+		return nil, d.systemErr
+	}
+	return d.SimulatedDevice.GetSystemInfo()
+}
+
+func TestCardInfoFollowsDriver(t *testing.T) {
+	scenario := &nvidia.Scenario{DriverVersion: "470.82.01", CUDAVersion: "11.4", Cards: []nvidia.SimCard{{MemoryTotal: 15109}}}
+	device := &flakyDevice{SimulatedDevice: nvidia.NewSimulatedDevice(scenario)}
+	e, _ := newTestExporter(t, device, 10*time.Second, Options{})
+	drivers := func() []string {
+		var found []string
+		for _, metric := range collect(t, e.collector.GPUInfo) {
+			for _, label := range metric.Label {
+				if label.GetName() == "driver_version" {
+					found = append(found, label.GetValue())
+				}
+			}
+		}
+		return found
+	}
+
+	e.Once()
+	if got := drivers(); !reflect.DeepEqual(got, []string{"470.82.01"}) {
+		t.Fatalf("drivers = %v, want 470.82.01", got)
+	}
+	device.systemErr = errors.New("nvml lost")
+	e.Once()
+	if got := drivers(); !reflect.DeepEqual(got, []string{"470.82.01"}) {
+		t.Errorf("drivers after a failed read = %v, want the last known 470.82.01", got)
+	}
+	device.systemErr = nil
+	scenario.DriverVersion = "510.47.03"
+	e.Once()
+	if got := drivers(); !reflect.DeepEqual(got, []string{"510.47.03"}) {
+		t.Errorf("drivers after an upgrade = %v, want 510.47.03 only", got)
+	}
+	if card := e.cards[0]; card.labels.UUID == "" || card.info.Driver != "510.47.03" {
+		t.Errorf("card = %+v, want its identity with the new driver", card)
+	}
+}
+
+// usageDevice is a simulated card whose processes can be made to fail to read.
+type usageDevice struct {
+	*nvidia.SimulatedDevice
+	usageErr error
+}
+
+func (d *usageDevice) GetDeviceUsage(cardNum int) (map[int]*tree.ProcessUsage, error) {
+	if d.usageErr != nil {
+		return nil, d.usageErr
+	}
+	return d.SimulatedDevice.GetDeviceUsage(cardNum)
+}
+
+func TestUnattributedDroppedOnFailedRead(t *testing.T) {
+	device := &usageDevice{SimulatedDevice: nvidia.NewSimulatedDevice(&nvidia.Scenario{Cards: []nvidia.SimCard{{
+		MemoryTotal: 15109,
+		Processes:   []nvidia.SimProcess{{Pid: 300, Steps: steps(0, 100, 10)}},
+	}}})}
+	e, _ := newTestExporter(t, device, 10*time.Second, Options{ProcRoot: writeProc(t, nil)})
+	e.Once()
+	if mem, ok := gauge(t, e.collector.UnattributedMem, nil); !ok || mem != 100 {
+		t.Fatalf("unattributed memory = %v, %v, want 100", mem, ok)
+	}
+	device.usageErr = errors.New("nvml lost")
+	e.Once()
+	if series := collect(t, e.collector.UnattributedMem); len(series) != 0 {
+		t.Errorf("unattributed memory kept after a failed read: %v", series)
+	}
+	if series := collect(t, e.collector.UnattributedCore); len(series) != 0 {
+		t.Errorf("unattributed core kept after a failed read: %v", series)
+	}
+	device.usageErr = nil
+	e.Once()
+	if mem, ok := gauge(t, e.collector.UnattributedMem, nil); !ok || mem != 100 {
+		t.Errorf("unattributed memory once the card answers = %v, %v, want 100", mem, ok)
+	}
+}
+
+// stubWatcher answers pings with the errors the test queues, nil once none is left.
+type stubWatcher struct {
+	runs  int
+	pings []error
+}
+
+func (w *stubWatcher) Run(stop <-chan struct{}) { w.runs++ }
+func (w *stubWatcher) GetPod(namespace, name string) (*v1.Pod, error) {
+	return nil, errors.New("no pod")
+}
+func (w *stubWatcher) GetPodByUID(UID string) (*v1.Pod, bool) { return nil, false }
+func (w *stubWatcher) Eventf(pod *v1.Pod, eventType, reason, messageFmt string, args ...interface{}) {
+}
+func (w *stubWatcher) Ping() error {
+	if len(w.pings) == 0 {
+		return nil
+	}
+	err := w.pings[0]
+	w.pings = w.pings[1:]
+	return err
+}
+
+func TestConnectRetriesAndRecovers(t *testing.T) {
+	const interval = 10 * time.Second
+	e, _ := newTestExporter(t, nvidia.NewSimulatedDevice(&nvidia.Scenario{}), interval, Options{Kubernetes: true})
+	// the API server cannot be reached three times, then answers except for one
+	// ping
+	watcher := &stubWatcher{pings: []error{nil, errors.New("connection refused")}}
+	attempts := 0
+	e.newWatcher = func() (kubepods.Watcher, error) {
+		attempts++
+		if attempts <= 3 {
+			return nil, errors.New("connection refused")
+		}
+		return watcher, nil
+	}
+	var waits []time.Duration
+	var connected []float64
+	stop := make(chan struct{})
+	e.after = func(d time.Duration) <-chan time.Time {
+		waits = append(waits, d)
+		m := new(dto.Metric)
+		if err := e.collector.KubeConnected.Write(m); err != nil {
+			t.Fatal(err)
+		}
+		connected = append(connected, m.GetGauge().GetValue())
+		if len(waits) == 7 {
+			close(stop)
+			return nil
+		}
+		fired := make(chan time.Time, 1)
+		fired <- time.Time{}
+		return fired
+	}
+	e.connect(stop)
+
+	wantWaits := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, interval, interval, time.Second, interval}
+	if !reflect.DeepEqual(waits, wantWaits) {
+		t.Errorf("waits = %v, want %v", waits, wantWaits)
+	}
+	if want := []float64{0, 0, 0, 1, 1, 0, 1}; !reflect.DeepEqual(connected, want) {
+		t.Errorf("kubernetes_connected = %v, want %v", connected, want)
+	}
+	if attempts != 4 || watcher.runs != 1 || e.kubeWatcher() != watcher {
+		t.Errorf("%d attempts ran the watcher %d times, want it created and run once after 4", attempts, watcher.runs)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	for _, tc := range []struct {
+		retry, max, want time.Duration
+	}{
+		{retry: 0, max: time.Minute, want: connectRetry},
+		{retry: 4 * time.Second, max: time.Minute, want: 8 * time.Second},
+		{retry: 40 * time.Second, max: time.Minute, want: time.Minute},
+		{retry: 0, max: 500 * time.Millisecond, want: 500 * time.Millisecond},
+	} {
+		if got := backoff(tc.retry, tc.max); got != tc.want {
+			t.Errorf("backoff(%v, %v) = %v, want %v", tc.retry, tc.max, got, tc.want)
+		}
+	}
+}
+
+func TestRunWithoutKubernetes(t *testing.T) {
+	e, _ := newTestExporter(t, nvidia.NewSimulatedDevice(&nvidia.Scenario{}), 10*time.Millisecond, Options{})
+	e.collector.KubeConnected.Set(1)
+	e.newWatcher = func() (kubepods.Watcher, error) {
+		t.Error("watcher created with kubernetes off")
+		return nil, errors.New("off")
+	}
+	stop := make(chan struct{})
+	close(stop)
+	e.Run(stop)
+	m := new(dto.Metric)
+	if err := e.collector.KubeConnected.Write(m); err != nil {
+		t.Fatal(err)
+	}
+	if connected := m.GetGauge().GetValue(); connected != 0 {
+		t.Errorf("kubernetes_connected = %v with kubernetes off, want 0", connected)
+	}
+}
+
+// reinitDevice is a simulated card whose driver is lost until failures calls
+// failed, the session being initialized again on the next one.
+type reinitDevice struct {
+	*nvidia.SimulatedDevice
+	failures int
+	reinits  uint64
+	last     time.Time
+}
+
+func (d *reinitDevice) GetDeviceCount() (int, error) {
+	if d.failures > 0 {
+		d.failures--
+		if d.failures == 0 {
+			d.reinits++
+			d.last = time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+		}
+		return 0, errors.New("nvml: gpu is lost")
+	}
+	return d.SimulatedDevice.GetDeviceCount()
+}
+
+func (d *reinitDevice) Reinits() (uint64, time.Time) {
+	return d.reinits, d.last
+}
+
+func TestOnceRecoversLostSession(t *testing.T) {
+	device := &reinitDevice{
+		SimulatedDevice: nvidia.NewSimulatedDevice(&nvidia.Scenario{DriverVersion: "470.82.01", Cards: []nvidia.SimCard{{MemoryTotal: 15109}}}),
+		failures:        2,
+	}
+	e, _ := newTestExporter(t, device, 10*time.Second, Options{})
+	reinits := func() float64 {
+		m := new(dto.Metric)
+		if err := e.collector.BackendReinit.Write(m); err != nil {
+			t.Fatal(err)
+		}
+		return m.GetCounter().GetValue()
+	}
+	e.Once()
+	if got := reinits(); got != 0 {
+		t.Errorf("reinits while the session is lost = %v, want 0", got)
+	}
+	e.Once()
+	e.Once()
+	if got := reinits(); got != 1 {
+		t.Errorf("reinits once the session is back = %v, want 1", got)
+	}
+	if series := collect(t, e.collector.GPUInfo); len(series) != 1 {
+		t.Errorf("info of %d cards once the session is back, want 1", len(series))
+	}
+	e.Once()
+	if got := reinits(); got != 1 {
+		t.Errorf("reinits counted again in the next cycle = %v, want 1", got)
+	}
+}
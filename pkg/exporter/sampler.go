@@ -0,0 +1,160 @@
+package exporter
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/klog"
+	"nano-gpu-exporter/pkg/nvidia"
+	tree "nano-gpu-exporter/pkg/ptree"
+)
+
+// CardSample is everything read from one card in a collection cycle.
+type CardSample struct {
+	Info      *nvidia.DeviceInfo
+	Usage     map[int]*tree.ProcessUsage
+	MemUsed   uint64
+	MemTotal  uint64
+	CoreUtil  uint
+	MemUtil   uint
+	Telemetry *nvidia.Telemetry
+	Throttle  map[string]bool
+	MIG       []nvidia.MIGDevice
+	// Finished are the processes kept by accounting mode, nil unless it is on.
+	Finished []nvidia.AccountedProcess
+	Err      error
+}
+
+// Sampler reads all cards in parallel, so that the samples of every card cover the
+// same window and a cycle takes about as long as the slowest card.
+type Sampler struct {
+	device     nvidia.Device
+	workers    int
+	timeout    time.Duration
+	groups     nvidia.Groups
+	accounting bool
+	// inFlight holds the cards whose sample timed out and has not returned yet.
+	mu       sync.Mutex
+	inFlight map[int]bool
+}
+
+func NewSampler(device nvidia.Device, workers int, timeout time.Duration, groups nvidia.Groups, accounting bool) *Sampler {
+	if workers <= 0 {
+		workers = 1
+	}
+	return &Sampler{
+		device:     device,
+		workers:    workers,
+		timeout:    timeout,
+		groups:     groups,
+		accounting: accounting,
+		inFlight:   make(map[int]bool),
+	}
+}
+
+// Sample reads cardCount cards. A card that fails or does not answer within the
+// timeout gets a sample with Err set.
+func (s *Sampler) Sample(cardCount int) []CardSample {
+	samples := make([]CardSample, cardCount)
+	cards := make(chan int)
+	wg := sync.WaitGroup{}
+	for w := 0; w < s.workers && w < cardCount; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range cards {
+				samples[i] = s.sampleWithTimeout(i)
+			}
+		}()
+	}
+	for i := 0; i < cardCount; i++ {
+		cards <- i
+	}
+	close(cards)
+	wg.Wait()
+	return samples
+}
+
+func (s *Sampler) sampleWithTimeout(i int) CardSample {
+	if s.timeout <= 0 {
+		return s.sample(i)
+	}
+	// NVML calls cannot be cancelled: a card that hangs keeps its goroutine until
+	// the call returns, and the late sample is dropped. The card is skipped until
+	// then, so a hung card holds one goroutine rather than one per cycle.
+	s.mu.Lock()
+	if s.inFlight[i] {
+		s.mu.Unlock()
+		klog.Errorf("Skipping GPU %d, its previous sample has not returned", i)
+		return CardSample{Err: fmt.Errorf("previous sample of gpu %d has not returned", i)}
+	}
+	s.inFlight[i] = true
+	s.mu.Unlock()
+	result := make(chan CardSample, 1)
+	go func() {
+		sample := s.sample(i)
+		s.mu.Lock()
+		delete(s.inFlight, i)
+		s.mu.Unlock()
+		result <- sample
+	}()
+	timer := time.NewTimer(s.timeout)
+	defer timer.Stop()
+	select {
+	case sample := <-result:
+		return sample
+	case <-timer.C:
+		klog.Errorf("Sampling GPU %d timed out after %s", i, s.timeout)
+		return CardSample{Err: fmt.Errorf("sampling gpu %d timed out", i)}
+	}
+}
+
+// sample stops at the first failing call after the card info; the fields read
+// before it are kept.
+func (s *Sampler) sample(i int) CardSample {
+	var sample CardSample
+	info, err := s.device.GetDeviceInfo(i)
+	if err != nil {
+		klog.Errorf("Cannot get info of GPU %d: %v", i, err)
+	}
+	sample.Info = info
+	sample.MemUsed, sample.MemTotal, sample.Err = s.device.GetDeviceMemory(i)
+	if sample.Err != nil {
+		klog.Errorf("Cannot get memory of GPU %d: %v", i, sample.Err)
+		return sample
+	}
+	sample.CoreUtil, sample.MemUtil, sample.Err = s.device.GetDeviceUtilization(i)
+	if sample.Err != nil {
+		klog.Errorf("Cannot get utilization of GPU %d: %v", i, sample.Err)
+		return sample
+	}
+	sample.Telemetry, sample.Err = s.device.GetDeviceTelemetry(i, s.groups)
+	if sample.Err != nil {
+		klog.Errorf("Cannot get telemetry of GPU %d: %v", i, sample.Err)
+		return sample
+	}
+	sample.Throttle, sample.Err = s.device.GetDeviceThrottle(i)
+	if sample.Err != nil {
+		klog.Errorf("Cannot get throttle reasons of GPU %d: %v", i, sample.Err)
+		return sample
+	}
+	sample.MIG, sample.Err = s.device.GetMIGDevices(i)
+	if sample.Err != nil {
+		klog.Errorf("Cannot get mig devices of GPU %d: %v", i, sample.Err)
+		return sample
+	}
+	sample.Usage, sample.Err = s.device.GetDeviceUsage(i)
+	if sample.Err != nil {
+		klog.Errorf("Cannot get processusage in GPU %d: %v", i, sample.Err)
+		return sample
+	}
+	if s.accounting {
+		finished, err := s.device.GetAccountedProcesses(i)
+		if err != nil {
+			klog.Errorf("Cannot get finished processes of GPU %d: %v", i, err)
+		}
+		sample.Finished = finished
+	}
+	return sample
+}
@@ -0,0 +1,58 @@
+package exporter
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"nano-gpu-exporter/pkg/nvidia"
+)
+
+// hangingDevice is a simulated card whose memory call blocks until release is closed.
+type hangingDevice struct {
+	*nvidia.SimulatedDevice
+	release chan struct{}
+	calls   int32
+}
+
+func (d *hangingDevice) GetDeviceMemory(cardNum int) (uint64, uint64, error) {
+	atomic.AddInt32(&d.calls, 1)
+	<-d.release
+	return d.SimulatedDevice.GetDeviceMemory(cardNum)
+}
+
+func TestSamplerSkipsCardStillInFlight(t *testing.T) {
+	device := &hangingDevice{
+		SimulatedDevice: nvidia.NewSimulatedDevice(&nvidia.Scenario{Cards: []nvidia.SimCard{{MemoryTotal: 15109}}}),
+		release:         make(chan struct{}),
+	}
+	sampler := NewSampler(device, 1, 10*time.Millisecond, nvidia.Groups{}, false)
+
+	if sample := sampler.Sample(1)[0]; sample.Err == nil {
+		t.Fatal("sample of a hanging card did not time out")
+	}
+	for cycle := 0; cycle < 3; cycle++ {
+		if sample := sampler.Sample(1)[0]; sample.Err == nil {
+			t.Fatalf("cycle %d: sample of a card still in flight succeeded", cycle)
+		}
+	}
+	if calls := atomic.LoadInt32(&device.calls); calls != 1 {
+		t.Errorf("hanging card was sampled %d times, want 1", calls)
+	}
+
+	close(device.release)
+	deadline := time.Now().Add(time.Second)
+	for {
+		sample := sampler.Sample(1)[0]
+		if sample.Err == nil {
+			if sample.MemTotal != 15109 {
+				t.Errorf("MemTotal = %d, want 15109", sample.MemTotal)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("card never sampled again once it answered: %v", sample.Err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
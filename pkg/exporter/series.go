@@ -0,0 +1,20 @@
+package exporter
+
+import "strings"
+
+// seriesSet holds the label values of the series exported in a cycle, so that the
+// ones missing from the next cycle can be deleted.
+type seriesSet map[string][]string
+
+func (s seriesSet) add(labels []string) {
+	s[strings.Join(labels, "/")] = labels
+}
+
+// sweep deletes the series of s which next does not have.
+func (s seriesSet) sweep(next seriesSet, del func(labels []string)) {
+	for key, labels := range s {
+		if _, ok := next[key]; !ok {
+			del(labels)
+		}
+	}
+}
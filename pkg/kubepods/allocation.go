@@ -0,0 +1,58 @@
+package kubepods
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Allocations are the devices the device plugins gave the containers of the node.
+type Allocations struct {
+	Containers []ContainerDevices
+	// Allocatable are the device IDs of every resource, nil when the source cannot
+	// tell.
+	Allocatable map[string][]string
+}
+
+// ContainerDevices are the device IDs of one resource given to a container. The pod
+// is known by namespace and name, or by PodUID, depending on the source.
+type ContainerDevices struct {
+	Namespace string
+	Pod       string
+	PodUID    string
+	Container string
+	Resource  string
+	DeviceIDs []string
+}
+
+// AllocationSource tells which devices were allocated to which containers.
+type AllocationSource interface {
+	Allocations() (*Allocations, error)
+}
+
+// DeviceCard returns the index of the card a device ID belongs to. Device plugins
+// name devices after the UUID of the card, alone or followed by a replica suffix
+// (e.g. GPU-<uuid>::1 or GPU-<uuid>-3 when a card is shared), or after its index,
+// which plugins splitting a card in percents or cores follow with the share, e.g.
+// 0-42.
+func DeviceCard(ID string, uuids map[string]int) (int, bool) {
+	if card, ok := uuids[ID]; ok {
+		return card, true
+	}
+	for uuid, card := range uuids {
+		if strings.HasPrefix(ID, uuid) {
+			return card, true
+		}
+	}
+	fields := strings.FieldsFunc(ID, func(r rune) bool { return r == '-' || r == '_' || r == ':' })
+	if len(fields) == 0 {
+		return 0, false
+	}
+	if card, err := strconv.Atoi(fields[0]); err == nil {
+		for _, index := range uuids {
+			if index == card {
+				return card, true
+			}
+		}
+	}
+	return 0, false
+}
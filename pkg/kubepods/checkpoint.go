@@ -0,0 +1,122 @@
+package kubepods
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"k8s.io/klog"
+)
+
+// DeviceCheckpoint is where the kubelet keeps the devices it allocated to every
+// container.
+const DeviceCheckpoint = "/var/lib/kubelet/device-plugins/kubelet_internal_checkpoint"
+
+// checkpoint is kubelet_internal_checkpoint. DeviceIDs of an entry are a list
+// before v1 (kubelet < 1.20) and a list per NUMA node since.
+type checkpoint struct {
+	Data struct {
+		PodDeviceEntries []struct {
+			PodUID        string
+			ContainerName string
+			ResourceName  string
+			DeviceIDs     json.RawMessage
+		}
+		RegisteredDevices map[string][]string
+	}
+}
+
+// CheckpointSource reads the allocations from the device checkpoint of the kubelet,
+// for nodes where the pod resources API is off. The file is read again whenever it
+// changes.
+type CheckpointSource struct {
+	path        string
+	mu          sync.Mutex
+	modified    time.Time
+	allocations *Allocations
+}
+
+func NewCheckpointSource(path string) *CheckpointSource {
+	return &CheckpointSource{path: path}
+}
+
+func (s *CheckpointSource) Allocations() (*Allocations, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return nil, err
+	}
+	if s.allocations != nil && info.ModTime().Equal(s.modified) {
+		return s.allocations, nil
+	}
+	data, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return nil, err
+	}
+	allocations, err := parseCheckpoint(data)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse %s: %v", s.path, err)
+	}
+	klog.V(4).Infof("Read %d device allocations from %s", len(allocations.Containers), s.path)
+	s.modified, s.allocations = info.ModTime(), allocations
+	return allocations, nil
+}
+
+func parseCheckpoint(data []byte) (*Allocations, error) {
+	var cp checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, err
+	}
+	allocations := &Allocations{Allocatable: cp.Data.RegisteredDevices}
+	for _, entry := range cp.Data.PodDeviceEntries {
+		IDs, err := checkpointDeviceIDs(entry.DeviceIDs)
+		if err != nil {
+			return nil, fmt.Errorf("devices of pod %s container %s: %v", entry.PodUID, entry.ContainerName, err)
+		}
+		allocations.Containers = append(allocations.Containers, ContainerDevices{
+			PodUID:    entry.PodUID,
+			Container: entry.ContainerName,
+			Resource:  entry.ResourceName,
+			DeviceIDs: IDs,
+		})
+	}
+	return allocations, nil
+}
+
+// checkpointDeviceIDs reads the device IDs of an entry in either format.
+func checkpointDeviceIDs(raw json.RawMessage) ([]string, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	var IDs []string
+	if err := json.Unmarshal(raw, &IDs); err == nil {
+		return IDs, nil
+	}
+	var perNUMA map[string][]string
+	if err := json.Unmarshal(raw, &perNUMA); err != nil {
+		return nil, err
+	}
+	for _, numa := range perNUMA {
+		IDs = append(IDs, numa...)
+	}
+	return IDs, nil
+}
+
+// FallbackSource reads the allocations from the first of its sources which works.
+type FallbackSource []AllocationSource
+
+func (sources FallbackSource) Allocations() (*Allocations, error) {
+	var err error
+	for _, source := range sources {
+		var allocations *Allocations
+		if allocations, err = source.Allocations(); err == nil {
+			return allocations, nil
+		}
+		klog.V(4).Infof("Device allocations unavailable, trying the next source: %v", err)
+	}
+	return nil, err
+}
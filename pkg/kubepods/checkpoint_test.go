@@ -0,0 +1,110 @@
+package kubepods
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// checkpointV1 is written by kubelets since 1.20, with the devices of every entry
+// per NUMA node.
+const checkpointV1 = `{"Data":{"PodDeviceEntries":[
+{"PodUID":"6f1c4f6e-5b1a-4d3e-9f6a-0c2b1d9e8a70","ContainerName":"main","ResourceName":"nvidia.com/gpu","DeviceIDs":{"0":["GPU-8f3a","GPU-17c2"]},"AllocResp":"CgA="},
+{"PodUID":"0f6c2a3e-8d1b-4c55-9a7e-2b3c4d5e6f70","ContainerName":"server","ResourceName":"nvidia.com/gpu","DeviceIDs":{"1":["GPU-d044"]},"AllocResp":"CgA="}],
+"RegisteredDevices":{"nvidia.com/gpu":["GPU-8f3a","GPU-17c2","GPU-d044"]}},"Checksum":2930173741}`
+
+// checkpointPreV1 is written by kubelets before 1.20, with a plain list of devices.
+const checkpointPreV1 = `{"Data":{"PodDeviceEntries":[
+{"PodUID":"6f1c4f6e-5b1a-4d3e-9f6a-0c2b1d9e8a70","ContainerName":"main","ResourceName":"nvidia.com/gpu","DeviceIDs":["GPU-8f3a","GPU-17c2"],"AllocResp":"CgA="},
+{"PodUID":"0f6c2a3e-8d1b-4c55-9a7e-2b3c4d5e6f70","ContainerName":"server","ResourceName":"nvidia.com/gpu","DeviceIDs":["GPU-d044"],"AllocResp":"CgA="}],
+"RegisteredDevices":{"nvidia.com/gpu":["GPU-8f3a","GPU-17c2","GPU-d044"]}},"Checksum":1218935371}`
+
+func testDir(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "kubepods")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+func TestCheckpointSource(t *testing.T) {
+	want := &Allocations{
+		Containers: []ContainerDevices{
+			{PodUID: "6f1c4f6e-5b1a-4d3e-9f6a-0c2b1d9e8a70", Container: "main", Resource: "nvidia.com/gpu", DeviceIDs: []string{"GPU-8f3a", "GPU-17c2"}},
+			{PodUID: "0f6c2a3e-8d1b-4c55-9a7e-2b3c4d5e6f70", Container: "server", Resource: "nvidia.com/gpu", DeviceIDs: []string{"GPU-d044"}},
+		},
+		Allocatable: map[string][]string{"nvidia.com/gpu": {"GPU-8f3a", "GPU-17c2", "GPU-d044"}},
+	}
+	for _, tc := range []struct {
+		name    string
+		content *string
+		want    *Allocations
+	}{
+		{name: "v1", content: stringPtr(checkpointV1), want: want},
+		{name: "pre-v1", content: stringPtr(checkpointPreV1), want: want},
+		{name: "missing"},
+		{name: "corrupt", content: stringPtr(checkpointV1[:len(checkpointV1)/2])},
+		{name: "unknown device ids", content: stringPtr(`{"Data":{"PodDeviceEntries":[{"PodUID":"u","DeviceIDs":"GPU-8f3a"}]}}`)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(testDir(t), "kubelet_internal_checkpoint")
+			if tc.content != nil {
+				if err := ioutil.WriteFile(path, []byte(*tc.content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			allocations, err := NewCheckpointSource(path).Allocations()
+			if tc.want == nil {
+				if err == nil {
+					t.Errorf("Allocations() = %+v, want an error", allocations)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(allocations, tc.want) {
+				t.Errorf("Allocations() = %+v, want %+v", allocations, tc.want)
+			}
+		})
+	}
+}
+
+func TestCheckpointSourceRereadsOnChange(t *testing.T) {
+	path := filepath.Join(testDir(t), "kubelet_internal_checkpoint")
+	modified := time.Now().Add(-time.Minute)
+	write := func(content string, modified time.Time) {
+		t.Helper()
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modified, modified); err != nil {
+			t.Fatal(err)
+		}
+	}
+	source := NewCheckpointSource(path)
+	write(checkpointPreV1, modified)
+	first, err := source.Allocations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the file is not read again while its modification time holds, so the
+	// corrupt content goes unnoticed
+	write("{", modified)
+	if again, err := source.Allocations(); err != nil || again != first {
+		t.Errorf("Allocations() with the same modification time = %p, %v, want the cached %p", again, err, first)
+	}
+	write(`{"Data":{"PodDeviceEntries":[]}}`, modified.Add(time.Second))
+	if changed, err := source.Allocations(); err != nil || len(changed.Containers) != 0 {
+		t.Errorf("Allocations() after a change = %+v, %v, want no containers", changed, err)
+	}
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
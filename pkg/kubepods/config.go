@@ -0,0 +1,37 @@
+package kubepods
+
+import (
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// ClientConfig is how the watcher reaches the API server.
+type ClientConfig struct {
+	// Kubeconfig is the kubeconfig file. When empty the files in KUBECONFIG, then
+	// ~/.kube/config are read, and the in-cluster config is used if none exists.
+	Kubeconfig string
+	// Context is the kubeconfig context, the current one when empty.
+	Context string
+	// QPS and Burst limit the requests to the API server, the client-go defaults
+	// apply when zero.
+	QPS   float32
+	Burst int
+}
+
+// RestConfig resolves the config the same way kubectl does.
+func (c ClientConfig) RestConfig() (*rest.Config, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = c.Kubeconfig
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: c.Context}
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides).ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+	if c.QPS > 0 {
+		config.QPS = c.QPS
+	}
+	if c.Burst > 0 {
+		config.Burst = c.Burst
+	}
+	return config, nil
+}
@@ -0,0 +1,108 @@
+package kubepods
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// kubeconfig writes a kubeconfig whose contexts each point at their own server,
+// the first one being current.
+func kubeconfig(t *testing.T, dir, name string, contexts ...string) string {
+	t.Helper()
+	content := "apiVersion: v1\nkind: Config\ncurrent-context: " + contexts[0] + "\nclusters:\n"
+	for _, context := range contexts {
+		content += fmt.Sprintf("- name: %s\n  cluster:\n    server: https://%s.example:6443\n", context, context)
+	}
+	content += "contexts:\n"
+	for _, context := range contexts {
+		content += fmt.Sprintf("- name: %s\n  context:\n    cluster: %s\n    user: exporter\n", context, context)
+	}
+	content += "users:\n- name: exporter\n  user:\n    token: secret\n"
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// setenv sets key for the test, restoring it afterwards.
+func setenv(t *testing.T, key, value string) {
+	t.Helper()
+	old, set := os.LookupEnv(key)
+	if err := os.Setenv(key, value); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if set {
+			os.Setenv(key, old)
+		} else {
+			os.Unsetenv(key)
+		}
+	})
+}
+
+func TestRestConfig(t *testing.T) {
+	dir := testDir(t)
+	explicit := kubeconfig(t, dir, "explicit", "explicit", "other")
+	env := kubeconfig(t, dir, "env", "env")
+	missing := filepath.Join(dir, "missing")
+	for _, tc := range []struct {
+		name   string
+		env    string
+		config ClientConfig
+		// want is the server, empty when no config can be found
+		want string
+	}{
+		{name: "flag over environment", env: env, config: ClientConfig{Kubeconfig: explicit}, want: "https://explicit.example:6443"},
+		{name: "context", env: env, config: ClientConfig{Kubeconfig: explicit, Context: "other"}, want: "https://other.example:6443"},
+		{name: "environment", env: env, want: "https://env.example:6443"},
+		{name: "missing flag file", env: env, config: ClientConfig{Kubeconfig: missing}},
+		// in-cluster variables are set but the service account token is not
+		// mounted, no default server is made up
+		{name: "nothing found", env: missing},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			setenv(t, RecommendedKubeConfigPathEnv, tc.env)
+			setenv(t, "KUBERNETES_SERVICE_HOST", "10.96.0.1")
+			setenv(t, "KUBERNETES_SERVICE_PORT", "443")
+			config, err := tc.config.RestConfig()
+			if tc.want == "" {
+				if err == nil {
+					t.Errorf("RestConfig() = %s, want an error", config.Host)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if config.Host != tc.want {
+				t.Errorf("RestConfig() server = %s, want %s", config.Host, tc.want)
+			}
+		})
+	}
+}
+
+func TestRestConfigLimits(t *testing.T) {
+	path := kubeconfig(t, testDir(t), "config", "default")
+	for _, tc := range []struct {
+		config ClientConfig
+		qps    float32
+		burst  int
+	}{
+		// zero leaves the client-go defaults, applied when the client is created
+		{config: ClientConfig{Kubeconfig: path}},
+		{config: ClientConfig{Kubeconfig: path, QPS: 50, Burst: 100}, qps: 50, burst: 100},
+		{config: ClientConfig{Kubeconfig: path, QPS: -1, Burst: -1}},
+	} {
+		config, err := tc.config.RestConfig()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if config.QPS != tc.qps || config.Burst != tc.burst {
+			t.Errorf("RestConfig() of %+v has qps %v and burst %d, want %v and %d", tc.config, config.QPS, config.Burst, tc.qps, tc.burst)
+		}
+	}
+}
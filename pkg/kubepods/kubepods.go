@@ -4,7 +4,9 @@ import (
 	"k8s.io/client-go/util/workqueue"
 	log "k8s.io/klog/v2"
 	v12 "k8s.io/client-go/listers/core/v1"
-	"k8s.io/client-go/rest"
+	"k8s.io/client-go/kubernetes/scheme"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
 	"nano-gpu-exporter/pkg/util"
 	"time"
 
@@ -25,6 +27,9 @@ var (
 
 const(
 	RecommendedKubeConfigPathEnv = "KUBECONFIG"
+	// EventComponent is the source of the events the watcher records.
+	EventComponent = "nano-gpu-exporter"
+	uidIndex = "uid"
 )
 
 type Handler struct {
@@ -37,6 +42,12 @@ type Handler struct {
 type Watcher interface {
 	Run(stop <-chan struct{})
 	GetPod(namespace, name string) (*v1.Pod, error)
+	// GetPodByUID looks up any pod of the node, whatever resources it requests.
+	GetPodByUID(UID string) (*v1.Pod, bool)
+	// Eventf records an event on the pod.
+	Eventf(pod *v1.Pod, eventType, reason, messageFmt string, args ...interface{})
+	// Ping tells whether the API server answers.
+	Ping() error
 }
 
 type KubeWatcher struct {
@@ -48,72 +59,43 @@ type KubeWatcher struct {
 	podLister    v12.PodLister
 	podQueue     workqueue.RateLimitingInterface
 	handler      *Handler
+	recorder     record.EventRecorder
 }
 
-func NewWatcher(handler *Handler, gpuLabels []string, node string) Watcher {
-	//var kubeconfig *string
-	//if home := homedir.HomeDir(); home != "" {
-	//	kubeconfig = flag.String("kubeconfig", filepath.Join(home, ".kube", "config"), "(optional) absolute path to the kubeconfig file")
-	//} else {
-	//	kubeconfig = flag.String("kubeconfig", "", "absolute path to the kubeconfig file")
-	//}
-	//flag.Parse()
-	//
-	//config, err := clientcmd.BuildConfigFromFlags("", *kubeconfig)
-	//if err != nil {
-	//	klog.Fatalf("Could not get config")
-	//}
-    //------------------
-	// create the clientset
-	//clientset, err = kubernetes.NewForConfig(restConfig)
-
-	// Grab a dynamic interface that we can create informers from
-	//dc, err := dynamic.NewForConfig(cfg)
-	//if err != nil {
-	//	logrus.WithError(err).Fatal("could not generate dynamic client for config")
-	//}
-
-
-	config, err := rest.InClusterConfig()
+// NewWatcher fails when the API server cannot be reached.
+func NewWatcher(handler *Handler, gpuLabels []string, node string, kube ClientConfig) (Watcher, error) {
+	config, err := kube.RestConfig()
 	if err != nil {
-		klog.Fatalf("create watcher failed: %s", err.Error())
+		return nil, err
+	}
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := client.Discovery().ServerVersion(); err != nil {
+		return nil, err
 	}
-
-	//------------
-	//kubeConfig := ""
-	//if len(os.Getenv(RecommendedKubeConfigPathEnv)) > 0 {
-	//	// use the current context in kubeconfig
-	//	// This is very useful for running locally.
-	//	kubeConfig = os.Getenv(RecommendedKubeConfigPathEnv)
-	//}
-	//
-	//// Get kubernetes config.
-	//restConfig, err := clientcmd.BuildConfigFromFlags("", kubeConfig)
-	//if err != nil {
-	//	klog.Fatalf("Error building kubeconfig: %s", err.Error())
-	//}
-	//
-	//// create the clientset
-	//client, err := kubernetes.NewForConfig(restConfig)
-	//if err != nil {
-	//	klog.Fatalf("Failed to init rest config due to %v", err)
-	//}
-	//--------------
-	client, _ := kubernetes.NewForConfig(config)
 	informersFactory := informers.NewSharedInformerFactoryWithOptions(client, time.Second, informers.WithTweakListOptions(nodeNameFilter(node)))
 	labelSet := make(map[string]struct{})
 	for _, label := range gpuLabels {
 		labelSet[label] = struct{}{}
 	}
+	podInformer := informersFactory.Core().V1().Pods().Informer()
+	if err := podInformer.AddIndexers(cache.Indexers{uidIndex: podUID}); err != nil {
+		return nil, err
+	}
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&corev1.EventSinkImpl{Interface: client.CoreV1().Events("")})
 	return &KubeWatcher{
 		labelSet:     labelSet,
 		node:         node,
 		client:       client,
 		informers:    informersFactory,
 		podLister:    informersFactory.Core().V1().Pods().Lister(),
-		podInformers: informersFactory.Core().V1().Pods().Informer(),
+		podInformers: podInformer,
 		handler:      handler,
-	}
+		recorder:     broadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: EventComponent, Host: node}),
+	}, nil
 }
 
 func (w *KubeWatcher) Run(stop <-chan struct{}) {
@@ -170,4 +152,29 @@ func nodeNameFilter(nodeName string) func(options *metav1.ListOptions) {
 
 func (w *KubeWatcher) GetPod(namespace, name string) (*v1.Pod, error) {
 	return w.podLister.Pods(namespace).Get(name)
-}
\ No newline at end of file
+}
+func (w *KubeWatcher) GetPodByUID(UID string) (*v1.Pod, bool) {
+	objs, err := w.podInformers.GetIndexer().ByIndex(uidIndex, UID)
+	if err != nil || len(objs) == 0 {
+		return nil, false
+	}
+	pod, ok := objs[0].(*v1.Pod)
+	return pod, ok
+}
+
+func (w *KubeWatcher) Eventf(pod *v1.Pod, eventType, reason, messageFmt string, args ...interface{}) {
+	w.recorder.Eventf(pod, eventType, reason, messageFmt, args...)
+}
+
+func (w *KubeWatcher) Ping() error {
+	_, err := w.client.Discovery().ServerVersion()
+	return err
+}
+
+func podUID(obj interface{}) ([]string, error) {
+	pod, ok := obj.(*v1.Pod)
+	if !ok {
+		return nil, nil
+	}
+	return []string{string(pod.UID)}, nil
+}
@@ -0,0 +1,218 @@
+package kubepods
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	// PodResourcesSocket is where the kubelet serves the pod resources API.
+	PodResourcesSocket = "/var/lib/kubelet/pod-resources/kubelet.sock"
+
+	listMethod        = "/v1.PodResourcesLister/List"
+	allocatableMethod = "/v1.PodResourcesLister/GetAllocatableResources"
+	// podResourcesMaxSize is the largest response accepted, as the kubelet clients do.
+	podResourcesMaxSize = 16 * 1024 * 1024
+)
+
+// PodResourcesClient queries the pod resources API of the kubelet, v1. The few
+// messages it needs are encoded by hand instead of pulling in the generated code of
+// the kubelet.
+type PodResourcesClient struct {
+	conn    *grpc.ClientConn
+	timeout time.Duration
+}
+
+// NewPodResourcesClient connects to the kubelet socket; the connection is made
+// lazily, so a missing socket shows up on the first query.
+func NewPodResourcesClient(socket string, timeout time.Duration) (*PodResourcesClient, error) {
+	conn, err := grpc.Dial(socket,
+		grpc.WithInsecure(),
+		grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", addr)
+		}),
+		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(podResourcesMaxSize), grpc.ForceCodec(podResourcesCodec{})),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("cannot dial %s: %v", socket, err)
+	}
+	return &PodResourcesClient{conn: conn, timeout: timeout}, nil
+}
+
+// Allocations lists the devices of every container and the allocatable devices of
+// the node.
+func (c *PodResourcesClient) Allocations() (*Allocations, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	list := &listResponse{}
+	if err := c.conn.Invoke(ctx, listMethod, &emptyRequest{}, list); err != nil {
+		return nil, fmt.Errorf("cannot list pod resources: %v", err)
+	}
+	allocations := &Allocations{Containers: list.containers}
+	allocatable := &allocatableResponse{}
+	// GetAllocatableResources is behind a feature gate before kubelet 1.23, go on
+	// without it
+	if err := c.conn.Invoke(ctx, allocatableMethod, &emptyRequest{}, allocatable); err == nil {
+		allocations.Allocatable = allocatable.devices
+	}
+	return allocations, nil
+}
+
+func (c *PodResourcesClient) Close() error {
+	return c.conn.Close()
+}
+
+// emptyRequest is ListPodResourcesRequest and AllocatableResourcesRequest.
+type emptyRequest struct{}
+
+// listResponse is ListPodResourcesResponse:
+//   repeated PodResources pod_resources = 1;
+type listResponse struct {
+	containers []ContainerDevices
+}
+
+// allocatableResponse is AllocatableResourcesResponse:
+//   repeated ContainerDevices devices = 1;
+type allocatableResponse struct {
+	devices map[string][]string
+}
+
+// podResourcesCodec encodes the messages above in the protobuf wire format.
+type podResourcesCodec struct{}
+
+func (podResourcesCodec) Name() string {
+	return "proto"
+}
+
+func (podResourcesCodec) Marshal(v interface{}) ([]byte, error) {
+	if _, ok := v.(*emptyRequest); !ok {
+		return nil, fmt.Errorf("cannot marshal %T", v)
+	}
+	return nil, nil
+}
+
+func (podResourcesCodec) Unmarshal(data []byte, v interface{}) error {
+	switch message := v.(type) {
+	case *listResponse:
+		return eachField(data, func(num protowire.Number, value []byte) error {
+			if num != 1 {
+				return nil
+			}
+			containers, err := parsePodResources(value)
+			message.containers = append(message.containers, containers...)
+			return err
+		})
+	case *allocatableResponse:
+		message.devices = make(map[string][]string)
+		return eachField(data, func(num protowire.Number, value []byte) error {
+			if num != 1 {
+				return nil
+			}
+			resource, IDs, err := parseContainerDevices(value)
+			message.devices[resource] = append(message.devices[resource], IDs...)
+			return err
+		})
+	}
+	return fmt.Errorf("cannot unmarshal %T", v)
+}
+
+// parsePodResources parses PodResources:
+//   string name = 1;
+//   string namespace = 2;
+//   repeated ContainerResources containers = 3;
+func parsePodResources(data []byte) ([]ContainerDevices, error) {
+	var name, namespace string
+	var containers []ContainerDevices
+	err := eachField(data, func(num protowire.Number, value []byte) error {
+		switch num {
+		case 1:
+			name = string(value)
+		case 2:
+			namespace = string(value)
+		case 3:
+			devices, err := parseContainerResources(value)
+			containers = append(containers, devices...)
+			return err
+		}
+		return nil
+	})
+	for i := range containers {
+		containers[i].Namespace, containers[i].Pod = namespace, name
+	}
+	return containers, err
+}
+
+// parseContainerResources parses ContainerResources:
+//   string name = 1;
+//   repeated ContainerDevices devices = 2;
+func parseContainerResources(data []byte) ([]ContainerDevices, error) {
+	var name string
+	var devices []ContainerDevices
+	err := eachField(data, func(num protowire.Number, value []byte) error {
+		switch num {
+		case 1:
+			name = string(value)
+		case 2:
+			resource, IDs, err := parseContainerDevices(value)
+			devices = append(devices, ContainerDevices{Resource: resource, DeviceIDs: IDs})
+			return err
+		}
+		return nil
+	})
+	for i := range devices {
+		devices[i].Container = name
+	}
+	return devices, err
+}
+
+// parseContainerDevices parses ContainerDevices:
+//   string resource_name = 1;
+//   repeated string device_ids = 2;
+func parseContainerDevices(data []byte) (string, []string, error) {
+	var resource string
+	var IDs []string
+	err := eachField(data, func(num protowire.Number, value []byte) error {
+		switch num {
+		case 1:
+			resource = string(value)
+		case 2:
+			IDs = append(IDs, string(value))
+		}
+		return nil
+	})
+	return resource, IDs, err
+}
+
+// eachField calls fn with the length-delimited fields of a message, which are all
+// the fields read here; the others are skipped.
+func eachField(data []byte, fn func(num protowire.Number, value []byte) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		if typ != protowire.BytesType {
+			n = protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			data = data[n:]
+			continue
+		}
+		value, n := protowire.ConsumeBytes(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		if err := fn(num, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package kubepods
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// rawCodec passes the messages of the stub kubelet through as encoded bytes.
+type rawCodec struct{}
+
+func (rawCodec) Name() string {
+	return "proto"
+}
+
+func (rawCodec) Marshal(v interface{}) ([]byte, error) {
+	return *v.(*[]byte), nil
+}
+
+func (rawCodec) Unmarshal(data []byte, v interface{}) error {
+	*v.(*[]byte) = data
+	return nil
+}
+
+// message encodes the length-delimited fields of a message, in order.
+func message(fields ...interface{}) []byte {
+	var b []byte
+	for i := 0; i < len(fields); i += 2 {
+		b = protowire.AppendTag(b, protowire.Number(fields[i].(int)), protowire.BytesType)
+		switch value := fields[i+1].(type) {
+		case string:
+			b = protowire.AppendString(b, value)
+		case []byte:
+			b = protowire.AppendBytes(b, value)
+		}
+	}
+	return b
+}
+
+func containerDevices(resource string, IDs ...string) []byte {
+	b := message(1, resource)
+	for _, ID := range IDs {
+		b = append(b, message(2, ID)...)
+	}
+	// topology, which is not read
+	b = append(b, message(3, message(1, message(1, "0")))...)
+	return b
+}
+
+// serveKubelet starts a stub pod resources API on a temporary socket, answering
+// every method with its encoded response or with Unimplemented when it has none.
+func serveKubelet(t *testing.T, responses map[string][]byte) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "pod-resources")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	socket := filepath.Join(dir, "kubelet.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer(
+		grpc.ForceServerCodec(rawCodec{}),
+		grpc.UnknownServiceHandler(func(_ interface{}, stream grpc.ServerStream) error {
+			method, _ := grpc.MethodFromServerStream(stream)
+			var request []byte
+			if err := stream.RecvMsg(&request); err != nil {
+				return err
+			}
+			if len(request) != 0 {
+				return status.Errorf(codes.InvalidArgument, "request of %d bytes, want an empty one", len(request))
+			}
+			response, ok := responses[method]
+			if !ok {
+				return status.Errorf(codes.Unimplemented, "unknown method %s", method)
+			}
+			return stream.SendMsg(&response)
+		}),
+	)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+	return socket
+}
+
+func newTestClient(t *testing.T, socket string) *PodResourcesClient {
+	t.Helper()
+	client, err := NewPodResourcesClient(socket, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestPodResourcesAllocations(t *testing.T) {
+	list := message(
+		1, message(
+			1, "trainer", 2, "ml",
+			3, message(1, "main",
+				2, containerDevices("nvidia.com/gpu", "GPU-8f3a", "GPU-17c2"),
+				2, containerDevices("example.com/nic", "eth1")),
+			3, message(1, "sidecar")),
+		1, message(
+			1, "infer", 2, "default",
+			3, message(1, "server", 2, containerDevices("nano-gpu/gpu-percent", "0-42"))),
+	)
+	allocatable := message(
+		1, containerDevices("nvidia.com/gpu", "GPU-8f3a", "GPU-17c2"),
+		1, containerDevices("nvidia.com/gpu", "GPU-d044"),
+		1, containerDevices("example.com/nic", "eth1"),
+	)
+	client := newTestClient(t, serveKubelet(t, map[string][]byte{
+		listMethod:        list,
+		allocatableMethod: allocatable,
+	}))
+	allocations, err := client.Allocations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantContainers := []ContainerDevices{
+		{Namespace: "ml", Pod: "trainer", Container: "main", Resource: "nvidia.com/gpu", DeviceIDs: []string{"GPU-8f3a", "GPU-17c2"}},
+		{Namespace: "ml", Pod: "trainer", Container: "main", Resource: "example.com/nic", DeviceIDs: []string{"eth1"}},
+		{Namespace: "default", Pod: "infer", Container: "server", Resource: "nano-gpu/gpu-percent", DeviceIDs: []string{"0-42"}},
+	}
+	if !reflect.DeepEqual(allocations.Containers, wantContainers) {
+		t.Errorf("Containers = %+v, want %+v", allocations.Containers, wantContainers)
+	}
+	wantAllocatable := map[string][]string{
+		"nvidia.com/gpu":  {"GPU-8f3a", "GPU-17c2", "GPU-d044"},
+		"example.com/nic": {"eth1"},
+	}
+	if !reflect.DeepEqual(allocations.Allocatable, wantAllocatable) {
+		t.Errorf("Allocatable = %v, want %v", allocations.Allocatable, wantAllocatable)
+	}
+}
+
+func TestPodResourcesWithoutAllocatable(t *testing.T) {
+	// kubelets before 1.23 may not serve GetAllocatableResources
+	list := message(1, message(1, "trainer", 2, "ml",
+		3, message(1, "main", 2, containerDevices("nvidia.com/gpu", "GPU-8f3a"))))
+	client := newTestClient(t, serveKubelet(t, map[string][]byte{listMethod: list}))
+	allocations, err := client.Allocations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(allocations.Containers) != 1 || allocations.Allocatable != nil {
+		t.Errorf("Allocations() = %+v, want one container and no allocatable devices", allocations)
+	}
+}
+
+func TestPodResourcesListFails(t *testing.T) {
+	client := newTestClient(t, serveKubelet(t, map[string][]byte{}))
+	if _, err := client.Allocations(); err == nil {
+		t.Error("Allocations() succeeded without List")
+	}
+}
@@ -1,25 +1,131 @@
 package metrics
 
 import (
+	"strconv"
+	"time"
+
 	"github.com/prometheus/client_golang/prometheus"
+	"nano-gpu-exporter/pkg/nvidia"
+	tree "nano-gpu-exporter/pkg/ptree"
 )
 
+// cardLabels identify a card; the index alone may change across reboots and driver
+// upgrades.
+var cardLabels = []string{"node", "card", "uuid", "model", "pci_bus_id"}
+
+// cardLabelNames returns the labels of a card followed by extra, in a new slice so
+// no two metrics share a backing array.
+func cardLabelNames(extra ...string) []string {
+	return append(append([]string{}, cardLabels...), extra...)
+}
+
+type CardLabels struct {
+	Index    string
+	UUID     string
+	Model    string
+	PCIBusID string
+}
+
+func (l CardLabels) values(node string, extra ...string) []string {
+	return append([]string{node, l.Index, l.UUID, l.Model, l.PCIBusID}, extra...)
+}
+
+// CardInfo is the gpu_info of a card, MemoryTotal is in MiB.
+type CardInfo struct {
+	Driver      string
+	CUDA        string
+	VBIOS       string
+	MemoryTotal uint64
+}
+
+// migLabels identify a MIG device within a card.
+var migLabels = []string{"gpu_instance", "compute_instance", "mig_profile"}
+
+type MIGLabels struct {
+	GPUInstance     string
+	ComputeInstance string
+	Profile         string
+}
+
+func (l MIGLabels) values() []string {
+	return []string{l.GPUInstance, l.ComputeInstance, l.Profile}
+}
+
+func (i CardInfo) values(node string, card CardLabels) []string {
+	return card.values(node, i.Driver, i.CUDA, i.VBIOS, strconv.FormatUint(i.MemoryTotal, 10))
+}
+
 type Collector struct {
-	GPUCore           *prometheus.GaugeVec
-	GPUCoreUtil       *prometheus.GaugeVec
-	GPUMem            *prometheus.GaugeVec
-	GPUMemUtil        *prometheus.GaugeVec
-	PodCore           *prometheus.GaugeVec
-	PodCoreUtil       *prometheus.GaugeVec
-	PodCoreOccupyNode *prometheus.GaugeVec
-	PodMem            *prometheus.GaugeVec
-	PodMemUtil        *prometheus.GaugeVec
-	PodMemOccupyNode  *prometheus.GaugeVec
-	PodMemRequest     *prometheus.GaugeVec
-	ContainerCore     *prometheus.GaugeVec
-	ContainerCoreUtil *prometheus.GaugeVec
-	ContainerMem      *prometheus.GaugeVec
-	ContainerMemUtil  *prometheus.GaugeVec
+	GPUCore                *prometheus.GaugeVec
+	GPUCoreUtil            *prometheus.GaugeVec
+	GPUMem                 *prometheus.GaugeVec
+	GPUMemUtil             *prometheus.GaugeVec
+	GPUEnc                 *prometheus.GaugeVec
+	GPUDec                 *prometheus.GaugeVec
+	GPUMemBandwidth        *prometheus.GaugeVec
+	GPUEncoderUtil         *prometheus.GaugeVec
+	GPUDecoderUtil         *prometheus.GaugeVec
+	UnattributedCore       *prometheus.GaugeVec
+	UnattributedMem        *prometheus.GaugeVec
+	UnattributedProcCore   *prometheus.GaugeVec
+	UnattributedProcMem    *prometheus.GaugeVec
+	GPUDevicesAllocatable  *prometheus.GaugeVec
+	GPUDevicesAllocated    *prometheus.GaugeVec
+	GPUInfo                *prometheus.GaugeVec
+	GPUTemperature         *prometheus.GaugeVec
+	GPUPowerUsage          *prometheus.GaugeVec
+	GPUPowerLimit          *prometheus.GaugeVec
+	GPUSMClock             *prometheus.GaugeVec
+	GPUMemClock            *prometheus.GaugeVec
+	GPUFanSpeed            *prometheus.GaugeVec
+	GPUPState              *prometheus.GaugeVec
+	GPUMemCtrlUtil         *prometheus.GaugeVec
+	GPUBAR1Mem             *prometheus.GaugeVec
+	GPUBAR1MemTotal        *prometheus.GaugeVec
+	GPUHealth              *prometheus.GaugeVec
+	GPUXIDErrors           *prometheus.GaugeVec
+	GPULastXID             *prometheus.GaugeVec
+	GPUECCErrors           *prometheus.GaugeVec
+	GPURetiredPages        *prometheus.GaugeVec
+	GPURetiredPending      *prometheus.GaugeVec
+	GPURemappedRows        *prometheus.GaugeVec
+	GPURowRemapPending     *prometheus.GaugeVec
+	GPURowRemapFailed      *prometheus.GaugeVec
+	GPUThrottle            *prometheus.GaugeVec
+	MIGCore                *prometheus.GaugeVec
+	MIGMem                 *prometheus.GaugeVec
+	MIGMemTotal            *prometheus.GaugeVec
+	PodCore                *prometheus.GaugeVec
+	PodCoreUtil            *prometheus.GaugeVec
+	PodCoreOccupyNode      *prometheus.GaugeVec
+	PodMem                 *prometheus.GaugeVec
+	PodMemUtil             *prometheus.GaugeVec
+	PodMemOccupyNode       *prometheus.GaugeVec
+	PodMemRequest          *prometheus.GaugeVec
+	PodEnc                 *prometheus.GaugeVec
+	PodDec                 *prometheus.GaugeVec
+	PodMemBandwidth        *prometheus.GaugeVec
+	ContainerCore          *prometheus.GaugeVec
+	ContainerCoreUtil      *prometheus.GaugeVec
+	ContainerMem           *prometheus.GaugeVec
+	ContainerMemUtil       *prometheus.GaugeVec
+	ContainerEnc           *prometheus.GaugeVec
+	ContainerDec           *prometheus.GaugeVec
+	ContainerMemBandwidth  *prometheus.GaugeVec
+	ContainerFinishedProcs *prometheus.GaugeVec
+	ContainerFinishedCore  *prometheus.GaugeVec
+	ContainerFinishedMem   *prometheus.GaugeVec
+	ContainerGPUAssigned   *prometheus.GaugeVec
+	PodMemContext          *prometheus.GaugeVec
+	ContainerMemContext    *prometheus.GaugeVec
+	PodThrottle            *prometheus.GaugeVec
+	PodMIGCore             *prometheus.GaugeVec
+	PodMIGMem              *prometheus.GaugeVec
+	PodUnrequestedCore     *prometheus.GaugeVec
+	PodUnrequestedMem      *prometheus.GaugeVec
+	BackendReinit          prometheus.Counter
+	BackendLastReinit      prometheus.Gauge
+	KubeConnected          prometheus.Gauge
 }
 
 func NewCollector() *Collector {
@@ -29,105 +135,487 @@ func NewCollector() *Collector {
 				Name: "gpu_core_usage",
 				Help: "Usage of gpu core per card",
 			},
-			[]string{"node","card"},
+			cardLabels,
 		),
 		GPUCoreUtil: prometheus.NewGaugeVec(
 			prometheus.GaugeOpts{
 				Name: "gpu_core_utilization_percentage",
 				Help: "Utilization of gpu core per card",
 			},
-			[]string{"node","card"},
+			cardLabels,
 		),
 		GPUMem: prometheus.NewGaugeVec(
 			prometheus.GaugeOpts{
 				Name: "gpu_mem_usage",
 				Help: "Usage of gpu memory per card",
 			},
-			[]string{"node","card"},
+			cardLabels,
 		),
 		GPUMemUtil: prometheus.NewGaugeVec(
 			prometheus.GaugeOpts{
 				Name: "gpu_mem_utilization_percentage",
 				Help: "Utilization of gpu memory per card",
 			},
-			[]string{"node","card"},
+			cardLabels,
+		),
+		GPUEnc: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "gpu_enc_usage",
+				Help: "Usage of the gpu video encoder by the pods on the card",
+			},
+			cardLabels,
+		),
+		GPUDec: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "gpu_dec_usage",
+				Help: "Usage of the gpu video decoder by the pods on the card",
+			},
+			cardLabels,
+		),
+		GPUMemBandwidth: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "gpu_mem_bandwidth_usage",
+				Help: "Usage of the gpu memory bandwidth by the pods on the card",
+			},
+			cardLabels,
+		),
+		GPUEncoderUtil: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "gpu_encoder_utilization_percentage",
+				Help: "Utilization of the gpu video encoder",
+			},
+			cardLabels,
+		),
+		GPUDecoderUtil: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "gpu_decoder_utilization_percentage",
+				Help: "Utilization of the gpu video decoder",
+			},
+			cardLabels,
+		),
+		UnattributedCore: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "gpu_unattributed_core_usage",
+				Help: "Usage of gpu core by processes outside the tracked pods",
+			},
+			cardLabels,
+		),
+		UnattributedMem: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "gpu_unattributed_mem_usage",
+				Help: "Usage of gpu memory by processes outside the tracked pods",
+			},
+			cardLabels,
+		),
+		UnattributedProcCore: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "gpu_unattributed_process_core_usage",
+				Help: "Usage of gpu core per process outside the tracked pods, exported at log verbosity 4",
+			},
+			cardLabelNames("pid", "command", "cgroup"),
+		),
+		UnattributedProcMem: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "gpu_unattributed_process_mem_usage",
+				Help: "Usage of gpu memory per process outside the tracked pods, exported at log verbosity 4",
+			},
+			cardLabelNames("pid", "command", "cgroup"),
+		),
+		GPUDevicesAllocatable: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "gpu_devices_allocatable",
+				Help: "Device plugin devices of the resource on the gpu card",
+			},
+			cardLabelNames("resource"),
+		),
+		GPUDevicesAllocated: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "gpu_devices_allocated",
+				Help: "Device plugin devices of the resource on the gpu card allocated to containers",
+			},
+			cardLabelNames("resource"),
+		),
+		GPUInfo: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "gpu_info",
+				Help: "Information about the gpu card and its driver, always 1",
+			},
+			cardLabelNames("driver_version", "cuda_version", "vbios_version", "memory_total"),
+		),
+		GPUTemperature: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "gpu_temperature_celsius",
+				Help: "Temperature of the gpu card",
+			},
+			cardLabels,
+		),
+		GPUPowerUsage: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "gpu_power_usage_watts",
+				Help: "Power draw of the gpu card",
+			},
+			cardLabels,
+		),
+		GPUPowerLimit: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "gpu_power_limit_watts",
+				Help: "Enforced power limit of the gpu card",
+			},
+			cardLabels,
+		),
+		GPUSMClock: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "gpu_sm_clock_mhz",
+				Help: "SM clock of the gpu card",
+			},
+			cardLabels,
+		),
+		GPUMemClock: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "gpu_mem_clock_mhz",
+				Help: "Memory clock of the gpu card",
+			},
+			cardLabels,
+		),
+		GPUFanSpeed: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "gpu_fan_speed_percentage",
+				Help: "Fan speed of the gpu card",
+			},
+			cardLabels,
+		),
+		GPUPState: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "gpu_performance_state",
+				Help: "Performance state of the gpu card, 0 is the highest",
+			},
+			cardLabels,
+		),
+		GPUMemCtrlUtil: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "gpu_mem_controller_utilization_percentage",
+				Help: "Utilization of the memory controller per card",
+			},
+			cardLabels,
+		),
+		GPUBAR1Mem: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "gpu_bar1_mem_usage",
+				Help: "Usage of BAR1 memory per card",
+			},
+			cardLabels,
+		),
+		GPUBAR1MemTotal: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "gpu_bar1_mem_total",
+				Help: "Total BAR1 memory per card",
+			},
+			cardLabels,
+		),
+		GPUHealth: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "gpu_health",
+				Help: "Health of the gpu card, 1 is healthy and 0 unhealthy",
+			},
+			cardLabels,
+		),
+		GPUXIDErrors: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "gpu_xid_errors",
+				Help: "XID errors of the gpu card since the exporter started",
+			},
+			cardLabels,
+		),
+		GPULastXID: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "gpu_last_xid",
+				Help: "Last XID error of the gpu card",
+			},
+			cardLabels,
+		),
+		GPUECCErrors: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "gpu_ecc_errors",
+				Help: "Volatile ECC errors of the gpu card",
+			},
+			cardLabelNames("type"),
+		),
+		GPURetiredPages: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "gpu_retired_pages",
+				Help: "Retired memory pages of the gpu card",
+			},
+			cardLabelNames("cause"),
+		),
+		GPURetiredPending: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "gpu_retired_pages_pending",
+				Help: "Whether the gpu card has pages waiting to be retired on the next reset",
+			},
+			cardLabels,
+		),
+		GPURemappedRows: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "gpu_remapped_rows",
+				Help: "Memory rows of the gpu card remapped after ECC errors",
+			},
+			cardLabelNames("cause"),
+		),
+		GPURowRemapPending: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "gpu_row_remapping_pending",
+				Help: "Whether the gpu card has rows waiting to be remapped on the next reset",
+			},
+			cardLabels,
+		),
+		GPURowRemapFailed: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "gpu_row_remapping_failed",
+				Help: "Whether a row remapping of the gpu card failed",
+			},
+			cardLabels,
+		),
+		GPUThrottle: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "gpu_clock_throttle_reason",
+				Help: "Whether the clocks of the gpu card are throttled for the reason",
+			},
+			cardLabelNames("reason"),
+		),
+		MIGCore: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "gpu_mig_core_usage",
+				Help: "Usage of gpu core per mig device",
+			},
+			cardLabelNames(migLabels...),
+		),
+		MIGMem: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "gpu_mig_mem_usage",
+				Help: "Usage of gpu memory per mig device",
+			},
+			cardLabelNames(migLabels...),
+		),
+		MIGMemTotal: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "gpu_mig_mem_total",
+				Help: "Total gpu memory of the mig device",
+			},
+			cardLabelNames(migLabels...),
 		),
 		PodCore: prometheus.NewGaugeVec(
 			prometheus.GaugeOpts{
 				Name: "pod_core_usage",
 				Help: "Usage of gpu core per pod",
 			},
-			[]string{"node","namespace", "pod"},
+			[]string{"node", "namespace", "pod"},
 		),
 		PodCoreUtil: prometheus.NewGaugeVec(
 			prometheus.GaugeOpts{
 				Name: "pod_core_utilization_percentage",
 				Help: "Utilization of gpu core",
 			},
-			[]string{"node","namespace", "pod"},
+			[]string{"node", "namespace", "pod"},
 		),
 		PodCoreOccupyNode: prometheus.NewGaugeVec(
 			prometheus.GaugeOpts{
 				Name: "pod_core_occupy_node_percentage",
 				Help: "Utilization of pod core occupied the node",
 			},
-			[]string{"node","namespace", "pod"},
+			[]string{"node", "namespace", "pod"},
 		),
 		PodMem: prometheus.NewGaugeVec(
 			prometheus.GaugeOpts{
 				Name: "pod_mem_usage",
 				Help: "Usage of gpu memory per pod",
 			},
-			[]string{"node","namespace", "pod"},
+			[]string{"node", "namespace", "pod"},
 		),
 		PodMemUtil: prometheus.NewGaugeVec(
 			prometheus.GaugeOpts{
 				Name: "pod_mem_utilization_percentage",
 				Help: "Utilization of pod memory",
 			},
-			[]string{"node","namespace", "pod"},
+			[]string{"node", "namespace", "pod"},
 		),
 		PodMemOccupyNode: prometheus.NewGaugeVec(
 			prometheus.GaugeOpts{
 				Name: "pod_mem_occupy_node_percentage",
 				Help: "Utilization of pod memory occupied the node",
 			},
-			[]string{"node","namespace", "pod"},
+			[]string{"node", "namespace", "pod"},
 		),
 		PodMemRequest: prometheus.NewGaugeVec(
 			prometheus.GaugeOpts{
 				Name: "pod_mem_request",
 				Help: "Request of pod memory",
 			},
-			[]string{"node","namespace", "pod"},
+			[]string{"node", "namespace", "pod"},
+		),
+		PodEnc: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "pod_enc_usage",
+				Help: "Usage of gpu video encoder per pod",
+			},
+			[]string{"node", "namespace", "pod"},
+		),
+		PodDec: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "pod_dec_usage",
+				Help: "Usage of gpu video decoder per pod",
+			},
+			[]string{"node", "namespace", "pod"},
+		),
+		PodMemBandwidth: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "pod_mem_bandwidth_usage",
+				Help: "Usage of gpu memory bandwidth per pod",
+			},
+			[]string{"node", "namespace", "pod"},
 		),
 		ContainerCore: prometheus.NewGaugeVec(
 			prometheus.GaugeOpts{
 				Name: "container_core_usage",
 				Help: "Usage of gpu computing per container",
 			},
-			[]string{"node","namespace", "pod", "container"},
+			[]string{"node", "namespace", "pod", "container"},
 		),
 		ContainerCoreUtil: prometheus.NewGaugeVec(
 			prometheus.GaugeOpts{
 				Name: "container_core_utilization_percentage",
 				Help: "Utilization of container core",
 			},
-			[]string{"node","namespace", "pod", "container"},
+			[]string{"node", "namespace", "pod", "container"},
 		),
 		ContainerMem: prometheus.NewGaugeVec(
 			prometheus.GaugeOpts{
 				Name: "container_mem_usage",
 				Help: "Usage of gpu memory per container",
 			},
-			[]string{"node","namespace", "pod", "container"},
+			[]string{"node", "namespace", "pod", "container"},
 		),
 		ContainerMemUtil: prometheus.NewGaugeVec(
 			prometheus.GaugeOpts{
 				Name: "container_mem_utilization_percentage",
 				Help: "Utilization of container memory",
 			},
-			[]string{"node","namespace", "pod", "container"},
+			[]string{"node", "namespace", "pod", "container"},
+		),
+		ContainerEnc: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "container_enc_usage",
+				Help: "Usage of gpu video encoder per container",
+			},
+			[]string{"node", "namespace", "pod", "container"},
+		),
+		ContainerDec: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "container_dec_usage",
+				Help: "Usage of gpu video decoder per container",
+			},
+			[]string{"node", "namespace", "pod", "container"},
+		),
+		ContainerMemBandwidth: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "container_mem_bandwidth_usage",
+				Help: "Usage of gpu memory bandwidth per container",
+			},
+			[]string{"node", "namespace", "pod", "container"},
+		),
+		ContainerFinishedProcs: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "container_finished_processes",
+				Help: "Gpu processes of the container which finished during the interval",
+			},
+			[]string{"node", "namespace", "pod", "container"},
+		),
+		ContainerFinishedCore: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "container_finished_core_usage",
+				Help: "Usage of gpu core during the interval by the processes of the container which finished",
+			},
+			[]string{"node", "namespace", "pod", "container"},
+		),
+		ContainerFinishedMem: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "container_finished_mem_max",
+				Help: "Most gpu memory used by a process of the container which finished during the interval",
+			},
+			[]string{"node", "namespace", "pod", "container"},
+		),
+		ContainerGPUAssigned: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "container_gpu_assigned",
+				Help: "Set for every gpu card the container was given, whether or not it uses it",
+			},
+			[]string{"node", "namespace", "pod", "container", "card", "uuid"},
+		),
+		PodMemContext: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "pod_mem_usage_by_context",
+				Help: "Usage of gpu memory per pod and kind of gpu context",
+			},
+			[]string{"node", "namespace", "pod", "context"},
+		),
+		ContainerMemContext: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "container_mem_usage_by_context",
+				Help: "Usage of gpu memory per container and kind of gpu context",
+			},
+			[]string{"node", "namespace", "pod", "container", "context"},
+		),
+		PodThrottle: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "pod_gpu_throttled",
+				Help: "Set when a gpu card used by the pod was slowed down for the reason during the interval",
+			},
+			[]string{"node", "namespace", "pod", "card", "uuid", "reason"},
+		),
+		PodMIGCore: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "pod_mig_core_usage",
+				Help: "Usage of gpu core per pod and mig device",
+			},
+			append([]string{"node", "namespace", "pod", "card", "uuid"}, migLabels...),
+		),
+		PodMIGMem: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "pod_mig_mem_usage",
+				Help: "Usage of gpu memory per pod and mig device",
+			},
+			append([]string{"node", "namespace", "pod", "card", "uuid"}, migLabels...),
+		),
+		PodUnrequestedCore: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "pod_unrequested_gpu_core_usage",
+				Help: "Usage of gpu core per card by a pod which requested no gpu resource",
+			},
+			[]string{"node", "namespace", "pod", "pod_name", "card", "uuid"},
+		),
+		PodUnrequestedMem: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "pod_unrequested_gpu_mem_usage",
+				Help: "Usage of gpu memory per card by a pod which requested no gpu resource",
+			},
+			[]string{"node", "namespace", "pod", "pod_name", "card", "uuid"},
+		),
+		BackendReinit: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: "gpu_backend_reinit_total",
+				Help: "Times the gpu backend was initialized again after a driver error",
+			},
+		),
+		BackendLastReinit: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "gpu_backend_last_reinit_timestamp_seconds",
+				Help: "Unix time the gpu backend was last initialized again",
+			},
+		),
+		KubeConnected: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "kubernetes_connected",
+				Help: "Whether the exporter reaches the kubernetes api server, pods are not exported while it does not",
+			},
 		),
 	}
 }
@@ -140,21 +628,318 @@ func (c *Collector) Register() {
 	prometheus.MustRegister(c.PodCore)
 	prometheus.MustRegister(c.PodCoreUtil)
 	prometheus.MustRegister(c.PodCoreOccupyNode)
+	prometheus.MustRegister(c.PodEnc)
+	prometheus.MustRegister(c.PodDec)
+	prometheus.MustRegister(c.PodMemBandwidth)
 	prometheus.MustRegister(c.GPUMem)
 	prometheus.MustRegister(c.GPUMemUtil)
 	prometheus.MustRegister(c.GPUCore)
 	prometheus.MustRegister(c.GPUCoreUtil)
+	prometheus.MustRegister(c.GPUEnc)
+	prometheus.MustRegister(c.GPUDec)
+	prometheus.MustRegister(c.GPUMemBandwidth)
+	prometheus.MustRegister(c.GPUEncoderUtil)
+	prometheus.MustRegister(c.GPUDecoderUtil)
+	prometheus.MustRegister(c.UnattributedCore)
+	prometheus.MustRegister(c.UnattributedMem)
+	prometheus.MustRegister(c.UnattributedProcCore)
+	prometheus.MustRegister(c.UnattributedProcMem)
+	prometheus.MustRegister(c.GPUDevicesAllocatable)
+	prometheus.MustRegister(c.GPUDevicesAllocated)
+	prometheus.MustRegister(c.GPUInfo)
+	prometheus.MustRegister(c.GPUTemperature)
+	prometheus.MustRegister(c.GPUPowerUsage)
+	prometheus.MustRegister(c.GPUPowerLimit)
+	prometheus.MustRegister(c.GPUSMClock)
+	prometheus.MustRegister(c.GPUMemClock)
+	prometheus.MustRegister(c.GPUFanSpeed)
+	prometheus.MustRegister(c.GPUPState)
+	prometheus.MustRegister(c.GPUMemCtrlUtil)
+	prometheus.MustRegister(c.GPUBAR1Mem)
+	prometheus.MustRegister(c.GPUBAR1MemTotal)
+	prometheus.MustRegister(c.GPUHealth)
+	prometheus.MustRegister(c.GPUXIDErrors)
+	prometheus.MustRegister(c.GPULastXID)
+	prometheus.MustRegister(c.GPUECCErrors)
+	prometheus.MustRegister(c.GPURetiredPages)
+	prometheus.MustRegister(c.GPURetiredPending)
+	prometheus.MustRegister(c.GPURemappedRows)
+	prometheus.MustRegister(c.GPURowRemapPending)
+	prometheus.MustRegister(c.GPURowRemapFailed)
+	prometheus.MustRegister(c.GPUThrottle)
+	prometheus.MustRegister(c.MIGCore)
+	prometheus.MustRegister(c.MIGMem)
+	prometheus.MustRegister(c.MIGMemTotal)
 	prometheus.MustRegister(c.ContainerCore)
 	prometheus.MustRegister(c.ContainerCoreUtil)
 	prometheus.MustRegister(c.ContainerMem)
 	prometheus.MustRegister(c.ContainerMemUtil)
+	prometheus.MustRegister(c.ContainerEnc)
+	prometheus.MustRegister(c.ContainerDec)
+	prometheus.MustRegister(c.ContainerMemBandwidth)
+	prometheus.MustRegister(c.ContainerFinishedProcs)
+	prometheus.MustRegister(c.ContainerFinishedCore)
+	prometheus.MustRegister(c.ContainerFinishedMem)
+	prometheus.MustRegister(c.ContainerGPUAssigned)
+	prometheus.MustRegister(c.PodMemContext)
+	prometheus.MustRegister(c.ContainerMemContext)
+	prometheus.MustRegister(c.PodThrottle)
+	prometheus.MustRegister(c.PodMIGCore)
+	prometheus.MustRegister(c.PodMIGMem)
+	prometheus.MustRegister(c.PodUnrequestedCore)
+	prometheus.MustRegister(c.PodUnrequestedMem)
+	prometheus.MustRegister(c.BackendReinit)
+	prometheus.MustRegister(c.BackendLastReinit)
+	prometheus.MustRegister(c.KubeConnected)
+}
+
+func (c *Collector) Card(node string, card CardLabels, core, mem, coreUtil, memUtil float64) {
+	c.GPUCore.WithLabelValues(card.values(node)...).Set(core)
+	c.GPUMem.WithLabelValues(card.values(node)...).Set(mem)
+	c.GPUCoreUtil.WithLabelValues(card.values(node)...).Set(coreUtil)
+	c.GPUMemUtil.WithLabelValues(card.values(node)...).Set(memUtil)
+}
+
+// CardEngines sets the encoder, decoder and memory bandwidth usage of the pods on
+// a card.
+func (c *Collector) CardEngines(node string, card CardLabels, usage tree.CardUsage) {
+	c.GPUEnc.WithLabelValues(card.values(node)...).Set(usage.Enc)
+	c.GPUDec.WithLabelValues(card.values(node)...).Set(usage.Dec)
+	c.GPUMemBandwidth.WithLabelValues(card.values(node)...).Set(usage.MemBandwidth)
+}
+
+// Unattributed sets the usage of a card by processes outside the tracked pods.
+func (c *Collector) Unattributed(node string, card CardLabels, core, mem float64) {
+	c.UnattributedCore.WithLabelValues(card.values(node)...).Set(core)
+	c.UnattributedMem.WithLabelValues(card.values(node)...).Set(mem)
+}
+
+// DeleteUnattributed removes the usage outside the tracked pods of a card, e.g.
+// when its processes could not be read.
+func (c *Collector) DeleteUnattributed(node string, card CardLabels) {
+	c.UnattributedCore.DeleteLabelValues(card.values(node)...)
+	c.UnattributedMem.DeleteLabelValues(card.values(node)...)
+}
+
+// UnattributedProcess sets the usage of one process outside the tracked pods and
+// returns the label values of its series, which DeleteUnattributedProcess takes.
+func (c *Collector) UnattributedProcess(node string, card CardLabels, pid int, command, cgroup string, core, mem float64) []string {
+	labels := card.values(node, strconv.Itoa(pid), command, cgroup)
+	c.UnattributedProcCore.WithLabelValues(labels...).Set(core)
+	c.UnattributedProcMem.WithLabelValues(labels...).Set(mem)
+	return labels
+}
+
+func (c *Collector) DeleteUnattributedProcess(labels []string) {
+	c.UnattributedProcCore.DeleteLabelValues(labels...)
+	c.UnattributedProcMem.DeleteLabelValues(labels...)
+}
+
+// DevicesAllocatable sets the devices of a resource on a card and returns the label
+// values of the series, which DeleteDevices takes.
+func (c *Collector) DevicesAllocatable(node string, card CardLabels, resource string, devices float64) []string {
+	labels := card.values(node, resource)
+	c.GPUDevicesAllocatable.WithLabelValues(labels...).Set(devices)
+	return labels
 }
 
-func (c *Collector) Card(node, id string, core, mem, coreUtil, memUtil float64) {
-	c.GPUCore.WithLabelValues(node, id).Set(core)
-	c.GPUMem.WithLabelValues(node,id).Set(mem)
-	c.GPUCoreUtil.WithLabelValues(node,id).Set(coreUtil)
-	c.GPUMemUtil.WithLabelValues(node,id).Set(memUtil)
+// DevicesAllocated sets the devices of a resource on a card allocated to containers
+// and returns the label values of the series, which DeleteDevices takes.
+func (c *Collector) DevicesAllocated(node string, card CardLabels, resource string, devices float64) []string {
+	labels := card.values(node, resource)
+	c.GPUDevicesAllocated.WithLabelValues(labels...).Set(devices)
+	return labels
+}
+
+func (c *Collector) DeleteDevices(labels []string) {
+	c.GPUDevicesAllocatable.DeleteLabelValues(labels...)
+	c.GPUDevicesAllocated.DeleteLabelValues(labels...)
+}
+
+func (c *Collector) CardInfo(node string, card CardLabels, info CardInfo) {
+	c.GPUInfo.WithLabelValues(info.values(node, card)...).Set(1)
+}
+
+// DeleteCardInfo removes the info series of a card, e.g. after its driver changed.
+func (c *Collector) DeleteCardInfo(node string, card CardLabels, info CardInfo) {
+	c.GPUInfo.DeleteLabelValues(info.values(node, card)...)
+}
+
+// DeleteCard removes every series of a card, e.g. after its index moved to
+// another card.
+func (c *Collector) DeleteCard(node string, card CardLabels, info CardInfo) {
+	c.GPUCore.DeleteLabelValues(card.values(node)...)
+	c.GPUMem.DeleteLabelValues(card.values(node)...)
+	c.GPUCoreUtil.DeleteLabelValues(card.values(node)...)
+	c.GPUMemUtil.DeleteLabelValues(card.values(node)...)
+	c.GPUEnc.DeleteLabelValues(card.values(node)...)
+	c.GPUDec.DeleteLabelValues(card.values(node)...)
+	c.GPUMemBandwidth.DeleteLabelValues(card.values(node)...)
+	c.GPUEncoderUtil.DeleteLabelValues(card.values(node)...)
+	c.GPUDecoderUtil.DeleteLabelValues(card.values(node)...)
+	c.UnattributedCore.DeleteLabelValues(card.values(node)...)
+	c.UnattributedMem.DeleteLabelValues(card.values(node)...)
+	c.GPUInfo.DeleteLabelValues(info.values(node, card)...)
+	c.GPUTemperature.DeleteLabelValues(card.values(node)...)
+	c.GPUPowerUsage.DeleteLabelValues(card.values(node)...)
+	c.GPUPowerLimit.DeleteLabelValues(card.values(node)...)
+	c.GPUSMClock.DeleteLabelValues(card.values(node)...)
+	c.GPUMemClock.DeleteLabelValues(card.values(node)...)
+	c.GPUFanSpeed.DeleteLabelValues(card.values(node)...)
+	c.GPUPState.DeleteLabelValues(card.values(node)...)
+	c.GPUMemCtrlUtil.DeleteLabelValues(card.values(node)...)
+	c.GPUBAR1Mem.DeleteLabelValues(card.values(node)...)
+	c.GPUBAR1MemTotal.DeleteLabelValues(card.values(node)...)
+	c.GPUHealth.DeleteLabelValues(card.values(node)...)
+	c.GPUXIDErrors.DeleteLabelValues(card.values(node)...)
+	c.GPULastXID.DeleteLabelValues(card.values(node)...)
+	c.GPUECCErrors.DeleteLabelValues(card.values(node, "corrected")...)
+	c.GPUECCErrors.DeleteLabelValues(card.values(node, "uncorrected")...)
+	c.GPURetiredPages.DeleteLabelValues(card.values(node, "single_bit")...)
+	c.GPURetiredPages.DeleteLabelValues(card.values(node, "double_bit")...)
+	c.GPURetiredPending.DeleteLabelValues(card.values(node)...)
+	c.GPURemappedRows.DeleteLabelValues(card.values(node, "correctable")...)
+	c.GPURemappedRows.DeleteLabelValues(card.values(node, "uncorrectable")...)
+	c.GPURowRemapPending.DeleteLabelValues(card.values(node)...)
+	c.GPURowRemapFailed.DeleteLabelValues(card.values(node)...)
+	for _, reason := range nvidia.ThrottleReasons {
+		c.GPUThrottle.DeleteLabelValues(card.values(node, reason)...)
+	}
+}
+
+// Throttle sets the throttle reasons of a card, reasons it cannot tell are removed.
+func (c *Collector) Throttle(node string, card CardLabels, reasons map[string]bool) {
+	for _, reason := range nvidia.ThrottleReasons {
+		active, ok := reasons[reason]
+		if !ok {
+			c.GPUThrottle.DeleteLabelValues(card.values(node, reason)...)
+			continue
+		}
+		value := 0.0
+		if active {
+			value = 1
+		}
+		c.GPUThrottle.WithLabelValues(card.values(node, reason)...).Set(value)
+	}
+}
+
+// PodThrottled marks a pod whose card was slowed down for reason and returns the
+// label values of the series, which DeletePodThrottled takes.
+func (c *Collector) PodThrottled(node, namespace, pod string, card CardLabels, reason string) []string {
+	labels := []string{node, namespace, pod, card.Index, card.UUID, reason}
+	c.PodThrottle.WithLabelValues(labels...).Set(1)
+	return labels
+}
+
+func (c *Collector) DeletePodThrottled(labels []string) {
+	c.PodThrottle.DeleteLabelValues(labels...)
+}
+
+// PodUnrequested sets the usage of a card by a pod which requested no gpu resource
+// and returns the label values of its series, which DeletePodUnrequested takes.
+func (c *Collector) PodUnrequested(node, namespace, pod, name string, card CardLabels, core, mem float64) []string {
+	labels := []string{node, namespace, pod, name, card.Index, card.UUID}
+	c.PodUnrequestedCore.WithLabelValues(labels...).Set(core)
+	c.PodUnrequestedMem.WithLabelValues(labels...).Set(mem)
+	return labels
+}
+
+func (c *Collector) DeletePodUnrequested(labels []string) {
+	c.PodUnrequestedCore.DeleteLabelValues(labels...)
+	c.PodUnrequestedMem.DeleteLabelValues(labels...)
+}
+
+// MIG sets the usage of a MIG device and returns the label values of its series,
+// which DeleteMIG takes. A nil core drops the core usage of the device.
+func (c *Collector) MIG(node string, card CardLabels, mig MIGLabels, core *float64, mem, memTotal float64) []string {
+	labels := card.values(node, mig.values()...)
+	setOrDelete(c.MIGCore, labels, core)
+	c.MIGMem.WithLabelValues(labels...).Set(mem)
+	c.MIGMemTotal.WithLabelValues(labels...).Set(memTotal)
+	return labels
+}
+
+func (c *Collector) DeleteMIG(labels []string) {
+	c.MIGCore.DeleteLabelValues(labels...)
+	c.MIGMem.DeleteLabelValues(labels...)
+	c.MIGMemTotal.DeleteLabelValues(labels...)
+}
+
+// PodMIG sets the usage of a pod on a MIG device and returns the label values of
+// its series, which DeletePodMIG takes. A nil core drops the core usage.
+func (c *Collector) PodMIG(node, namespace, pod string, card CardLabels, mig MIGLabels, core *float64, mem float64) []string {
+	labels := append([]string{node, namespace, pod, card.Index, card.UUID}, mig.values()...)
+	setOrDelete(c.PodMIGCore, labels, core)
+	c.PodMIGMem.WithLabelValues(labels...).Set(mem)
+	return labels
+}
+
+func (c *Collector) DeletePodMIG(labels []string) {
+	c.PodMIGCore.DeleteLabelValues(labels...)
+	c.PodMIGMem.DeleteLabelValues(labels...)
+}
+
+func (c *Collector) Health(node string, card CardLabels, h nvidia.CardHealth) {
+	healthy := 0.0
+	if h.Healthy {
+		healthy = 1
+	}
+	c.GPUHealth.WithLabelValues(card.values(node)...).Set(healthy)
+	c.GPUXIDErrors.WithLabelValues(card.values(node)...).Set(float64(h.XIDErrors))
+	c.GPULastXID.WithLabelValues(card.values(node)...).Set(float64(h.LastXID))
+	if h.ECCSupported {
+		c.GPUECCErrors.WithLabelValues(card.values(node, "corrected")...).Set(float64(h.ECCCorrected))
+		c.GPUECCErrors.WithLabelValues(card.values(node, "uncorrected")...).Set(float64(h.ECCUncorrected))
+	}
+	if h.RetiredPagesSupported {
+		pending := 0.0
+		if h.RetiredPagesPending {
+			pending = 1
+		}
+		c.GPURetiredPages.WithLabelValues(card.values(node, "single_bit")...).Set(float64(h.RetiredPagesSBE))
+		c.GPURetiredPages.WithLabelValues(card.values(node, "double_bit")...).Set(float64(h.RetiredPagesDBE))
+		c.GPURetiredPending.WithLabelValues(card.values(node)...).Set(pending)
+	}
+	if h.RowRemappingSupported {
+		pending, failed := 0.0, 0.0
+		if h.RowRemappingPending {
+			pending = 1
+		}
+		if h.RowRemappingFailed {
+			failed = 1
+		}
+		c.GPURemappedRows.WithLabelValues(card.values(node, "correctable")...).Set(float64(h.RemappedRowsCorrectable))
+		c.GPURemappedRows.WithLabelValues(card.values(node, "uncorrectable")...).Set(float64(h.RemappedRowsUncorrectable))
+		c.GPURowRemapPending.WithLabelValues(card.values(node)...).Set(pending)
+		c.GPURowRemapFailed.WithLabelValues(card.values(node)...).Set(failed)
+	}
+}
+
+// Telemetry sets the card readings of t; the series of readings t lacks are removed.
+func (c *Collector) Telemetry(node string, card CardLabels, t *nvidia.Telemetry) {
+	setOrDelete(c.GPUTemperature, card.values(node), t.Temperature)
+	setOrDelete(c.GPUPowerUsage, card.values(node), t.PowerUsage)
+	setOrDelete(c.GPUPowerLimit, card.values(node), t.PowerLimit)
+	setOrDelete(c.GPUSMClock, card.values(node), t.SMClock)
+	setOrDelete(c.GPUMemClock, card.values(node), t.MemClock)
+	setOrDelete(c.GPUFanSpeed, card.values(node), t.FanSpeed)
+	setOrDelete(c.GPUPState, card.values(node), t.PState)
+	setOrDelete(c.GPUBAR1Mem, card.values(node), t.BAR1Used)
+	setOrDelete(c.GPUBAR1MemTotal, card.values(node), t.BAR1Total)
+	setOrDelete(c.GPUEncoderUtil, card.values(node), t.EncoderUtil)
+	setOrDelete(c.GPUDecoderUtil, card.values(node), t.DecoderUtil)
+}
+
+func (c *Collector) MemControllerUtil(node string, card CardLabels, util float64) {
+	c.GPUMemCtrlUtil.WithLabelValues(card.values(node)...).Set(util)
+}
+
+func setOrDelete(vec *prometheus.GaugeVec, labels []string, value *float64) {
+	if value == nil {
+		vec.DeleteLabelValues(labels...)
+		return
+	}
+	vec.WithLabelValues(labels...).Set(*value)
 }
 
 func (c *Collector) Pod(node, namespace, name string, core, mem, coreUtil, memUtil, memRequest, coreOccupy, memOccupy float64) {
@@ -175,6 +960,12 @@ func (c *Collector) DeletePod(node, namespace, name string) {
 	c.PodCoreUtil.DeleteLabelValues(node, namespace, name)
 	c.PodMemOccupyNode.DeleteLabelValues(node, namespace, name)
 	c.PodCoreOccupyNode.DeleteLabelValues(node, namespace, name)
+	c.PodEnc.DeleteLabelValues(node, namespace, name)
+	c.PodDec.DeleteLabelValues(node, namespace, name)
+	c.PodMemBandwidth.DeleteLabelValues(node, namespace, name)
+	for _, context := range tree.Contexts {
+		c.PodMemContext.DeleteLabelValues(node, namespace, name, context)
+	}
 }
 
 func (c *Collector) DeleteContainer(node, namespace, pod, container string) {
@@ -182,6 +973,15 @@ func (c *Collector) DeleteContainer(node, namespace, pod, container string) {
 	c.ContainerMem.DeleteLabelValues(node, namespace, pod, container)
 	c.ContainerCoreUtil.DeleteLabelValues(node, namespace, pod, container)
 	c.ContainerMemUtil.DeleteLabelValues(node, namespace, pod, container)
+	c.ContainerEnc.DeleteLabelValues(node, namespace, pod, container)
+	c.ContainerDec.DeleteLabelValues(node, namespace, pod, container)
+	c.ContainerMemBandwidth.DeleteLabelValues(node, namespace, pod, container)
+	c.ContainerFinishedProcs.DeleteLabelValues(node, namespace, pod, container)
+	c.ContainerFinishedCore.DeleteLabelValues(node, namespace, pod, container)
+	c.ContainerFinishedMem.DeleteLabelValues(node, namespace, pod, container)
+	for _, context := range tree.Contexts {
+		c.ContainerMemContext.DeleteLabelValues(node, namespace, pod, container, context)
+	}
 }
 
 func (c *Collector) Container(node, namespace, pod, container string, core, mem, coreUtil, memUtil float64) {
@@ -191,4 +991,80 @@ func (c *Collector) Container(node, namespace, pod, container string, core, mem,
 	c.ContainerMemUtil.WithLabelValues(node, namespace, pod, container).Set(memUtil)
 }
 
+// PodEngines sets the encoder, decoder and memory bandwidth usage of a pod.
+func (c *Collector) PodEngines(node, namespace, name string, usage tree.CardUsage) {
+	c.PodEnc.WithLabelValues(node, namespace, name).Set(usage.Enc)
+	c.PodDec.WithLabelValues(node, namespace, name).Set(usage.Dec)
+	c.PodMemBandwidth.WithLabelValues(node, namespace, name).Set(usage.MemBandwidth)
+}
+
+func (c *Collector) ContainerEngines(node, namespace, pod, container string, usage tree.CardUsage) {
+	c.ContainerEnc.WithLabelValues(node, namespace, pod, container).Set(usage.Enc)
+	c.ContainerDec.WithLabelValues(node, namespace, pod, container).Set(usage.Dec)
+	c.ContainerMemBandwidth.WithLabelValues(node, namespace, pod, container).Set(usage.MemBandwidth)
+}
+
+// ContainerFinished sets what the processes of a container which finished during the
+// interval used, and returns the label values of its series, which
+// DeleteContainerFinished takes.
+func (c *Collector) ContainerFinished(node, namespace, pod, container string, count, core, maxMem float64) []string {
+	labels := []string{node, namespace, pod, container}
+	c.ContainerFinishedProcs.WithLabelValues(labels...).Set(count)
+	c.ContainerFinishedCore.WithLabelValues(labels...).Set(core)
+	c.ContainerFinishedMem.WithLabelValues(labels...).Set(maxMem)
+	return labels
+}
+
+func (c *Collector) DeleteContainerFinished(labels []string) {
+	c.ContainerFinishedProcs.DeleteLabelValues(labels...)
+	c.ContainerFinishedCore.DeleteLabelValues(labels...)
+	c.ContainerFinishedMem.DeleteLabelValues(labels...)
+}
+
+// ContainerAssigned marks a card the container was given and returns the label
+// values of the series, which DeleteContainerAssigned takes.
+func (c *Collector) ContainerAssigned(node, namespace, pod, container string, card CardLabels) []string {
+	labels := []string{node, namespace, pod, container, card.Index, card.UUID}
+	c.ContainerGPUAssigned.WithLabelValues(labels...).Set(1)
+	return labels
+}
+
+func (c *Collector) DeleteContainerAssigned(labels []string) {
+	c.ContainerGPUAssigned.DeleteLabelValues(labels...)
+}
+
+// PodContext sets the memory of a pod per kind of context; kinds the pod no longer
+// holds are removed.
+func (c *Collector) PodContext(node, namespace, name string, mem map[string]float64) {
+	for _, context := range tree.Contexts {
+		if value, ok := mem[context]; ok {
+			c.PodMemContext.WithLabelValues(node, namespace, name, context).Set(value)
+		} else {
+			c.PodMemContext.DeleteLabelValues(node, namespace, name, context)
+		}
+	}
+}
+
+func (c *Collector) ContainerContext(node, namespace, pod, container string, mem map[string]float64) {
+	for _, context := range tree.Contexts {
+		if value, ok := mem[context]; ok {
+			c.ContainerMemContext.WithLabelValues(node, namespace, pod, container, context).Set(value)
+		} else {
+			c.ContainerMemContext.DeleteLabelValues(node, namespace, pod, container, context)
+		}
+	}
+}
+
+func (c *Collector) Reinit(count float64, last time.Time) {
+	c.BackendReinit.Add(count)
+	c.BackendLastReinit.Set(float64(last.Unix()))
+}
 
+// KubernetesConnected sets whether the api server is reached.
+func (c *Collector) KubernetesConnected(connected bool) {
+	if connected {
+		c.KubeConnected.Set(1)
+	} else {
+		c.KubeConnected.Set(0)
+	}
+}
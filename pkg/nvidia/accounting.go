@@ -0,0 +1,23 @@
+package nvidia
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrAccountingUnsupported is returned by backends which cannot read accounting mode.
+var ErrAccountingUnsupported = errors.New("accounting mode is not supported by the gpu backend")
+
+// AccountedProcess is a process which finished on a card, as kept by accounting
+// mode after it exited.
+type AccountedProcess struct {
+	Pid int
+	// MaxMem is the most memory in MiB the process used.
+	MaxMem uint64
+	// SM and MemUtil are the utilization in percent averaged over the life of the
+	// process.
+	SM      float64
+	MemUtil float64
+	Start   time.Time
+	End     time.Time
+}
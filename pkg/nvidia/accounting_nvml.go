@@ -0,0 +1,79 @@
+//go:build cgo
+// +build cgo
+
+package nvidia
+
+import (
+	"time"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+)
+
+// EnableAccounting turns on accounting mode of a card unless it is already on,
+// which needs root.
+func (device *DeviceImpl) EnableAccounting(cardNum int) error {
+	dev, _, release, err := device.session.Handle(cardNum)
+	if err != nil {
+		return err
+	}
+	defer release()
+	mode, ret := dev.GetAccountingMode()
+	if ret == nvml.ERROR_NOT_SUPPORTED {
+		return ErrAccountingUnsupported
+	}
+	if err := check(ret); err != nil {
+		return device.session.Check(err)
+	}
+	if mode == nvml.FEATURE_ENABLED {
+		return nil
+	}
+	if err := check(dev.SetAccountingMode(nvml.FEATURE_ENABLED)); err != nil {
+		return device.session.Check(err)
+	}
+	return nil
+}
+
+// GetAccountedProcesses returns the processes kept by accounting mode which are no
+// longer running. The driver keeps a bounded number of them, so the oldest ones
+// drop out on busy cards.
+func (device *DeviceImpl) GetAccountedProcesses(cardNum int) ([]AccountedProcess, error) {
+	dev, _, release, err := device.session.Handle(cardNum)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	pids, ret := dev.GetAccountingPids()
+	if err := check(ret); err != nil {
+		return nil, device.session.Check(err)
+	}
+	var finished []AccountedProcess
+	for _, pid := range pids {
+		stats, ret := dev.GetAccountingStats(uint32(pid))
+		if ret == nvml.ERROR_NOT_FOUND {
+			// dropped out of the buffer since the pids were read
+			continue
+		}
+		if err := check(ret); err != nil {
+			return nil, device.session.Check(err)
+		}
+		if stats.IsRunning != 0 {
+			continue
+		}
+		finished = append(finished, accountedProcess(pid, stats))
+	}
+	return finished, nil
+}
+
+// accountedProcess converts the stats of a process, NVML gives its start in
+// microseconds since the epoch and how long it ran in milliseconds.
+func accountedProcess(pid int, stats nvml.AccountingStats) AccountedProcess {
+	start := time.Unix(0, int64(stats.StartTime)*int64(time.Microsecond))
+	return AccountedProcess{
+		Pid:     pid,
+		MaxMem:  stats.MaxMemoryUsage >> 20,
+		SM:      float64(stats.GpuUtilization),
+		MemUtil: float64(stats.MemoryUtilization),
+		Start:   start,
+		End:     start.Add(time.Duration(stats.Time) * time.Millisecond),
+	}
+}
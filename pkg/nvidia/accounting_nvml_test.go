@@ -0,0 +1,28 @@
+//go:build cgo
+// +build cgo
+
+package nvidia
+
+import (
+	"testing"
+	"time"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+)
+
+func TestAccountedProcess(t *testing.T) {
+	start := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	proc := accountedProcess(4242, nvml.AccountingStats{
+		GpuUtilization:    35,
+		MemoryUtilization: 12,
+		MaxMemoryUsage:    1536 << 20,
+		Time:              90500,
+		StartTime:         uint64(start.UnixNano() / int64(time.Microsecond)),
+	})
+	if proc.Pid != 4242 || proc.MaxMem != 1536 || proc.SM != 35 || proc.MemUtil != 12 {
+		t.Errorf("accountedProcess() = %+v", proc)
+	}
+	if !proc.Start.Equal(start) || !proc.End.Equal(start.Add(90500*time.Millisecond)) {
+		t.Errorf("process ran from %v to %v, want %v for 1m30.5s", proc.Start, proc.End, start)
+	}
+}
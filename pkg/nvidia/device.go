@@ -1,88 +1,104 @@
 package nvidia
 
 import (
-	"k8s.io/klog"
+	"fmt"
 	process "nano-gpu-exporter/pkg/ptree"
 	"time"
-	//"github.com/alex337/go-nvml"
-	"tkestack.io/nvml"
 )
 
+const (
+	BackendNVML      = "nvml"
+	BackendSimulated = "simulated"
+)
+
+// Device is the backend the exporter reads GPU cards from. Memory values are in MiB
+// and utilization values are percentages.
 type Device interface {
-	GetDeviceUsage(cardNum int)  (map[int]*process.ProcessUsage,error)
+	GetDeviceCount() (int, error)
+	GetDeviceMemory(cardNum int) (used uint64, total uint64, err error)
+	GetDeviceUtilization(cardNum int) (core uint, mem uint, err error)
+	GetDeviceUsage(cardNum int) (map[int]*process.ProcessUsage, error)
+	GetDeviceInfo(cardNum int) (*DeviceInfo, error)
+	GetSystemInfo() (*SystemInfo, error)
+	GetDeviceTelemetry(cardNum int, groups Groups) (*Telemetry, error)
+	GetDeviceHealth(cardNum int) (*HealthCounters, error)
+	// GetDeviceThrottle returns the clock throttle reasons the backend can tell for
+	// the card, true for the active ones.
+	GetDeviceThrottle(cardNum int) (map[string]bool, error)
+	// GetMIGDevices returns the MIG devices of a card, none when MIG mode is off.
+	GetMIGDevices(cardNum int) ([]MIGDevice, error)
+	// EnableAccounting turns on accounting mode of a card, so that it keeps the
+	// stats of processes after they exit.
+	EnableAccounting(cardNum int) error
+	// GetAccountedProcesses returns the processes which finished on a card since
+	// accounting mode was turned on.
+	GetAccountedProcesses(cardNum int) ([]AccountedProcess, error)
+	// GetDevicePids returns the pids of the processes running on a card. Unlike
+	// GetDeviceUsage it does not move the utilization window.
+	GetDevicePids(cardNum int) ([]int, error)
+	// WaitEvent waits up to timeout for a hardware fault of any card, it returns nil
+	// without error when none came.
+	WaitEvent(timeout time.Duration) (*Event, error)
+	// Reinits returns how often the backend had to be initialized again after a
+	// driver error, and when that last happened.
+	Reinits() (uint64, time.Time)
+	Close() error
 }
 
-type DeviceImpl struct {
+// DeviceInfo is what identifies a card, whatever index it gets.
+type DeviceInfo struct {
+	UUID     string
+	Model    string
+	PCIBusID string
+	VBIOS    string
+	// MemoryTotal is in MiB.
+	MemoryTotal uint64
+	// Minor is the minor number of the device node of the card, /dev/nvidia<Minor>.
+	Minor int
 }
 
-func (device *DeviceImpl) GetDeviceUsage(cardNum int)  (map[int]*process.ProcessUsage, error ){
-	nvml.Init()
-	defer nvml.Shutdown()
-	dev, _ := nvml.DeviceGetHandleByIndex(uint(cardNum))
-	processOnDevices, err := dev.DeviceGetComputeRunningProcesses(1024)
-	if err != nil {
-		klog.Warningf("Can't get processes info from device %d, error %s", uint(cardNum), err)
-		return nil, err
-	}
-	usageMap := make(map[int]*process.ProcessUsage)
-	for _, info := range processOnDevices {
-		_, exit := usageMap[int(info.Pid)]
-		if !exit {
-			usageMap[int(info.Pid)] = new(process.ProcessUsage)
-		}
-		usageMap[int(info.Pid)].GPUMem = float64(info.UsedGPUMemory >> 20)
-	}
-	processUtilization, err := dev.DeviceGetProcessUtilization(1024, time.Second)
-	if err != nil {
-		klog.Warningf("Can't get processes utilization from device %d, error %s", uint(cardNum), err)
-		return nil, err
-	}
-	for _, info := range processUtilization {
-		_, exit := usageMap[int(info.Pid)]
-		if !exit {
-			usageMap[int(info.Pid)] = new(process.ProcessUsage)
+type SystemInfo struct {
+	DriverVersion string
+	// CUDAVersion is the highest CUDA version the driver supports, empty when the
+	// backend cannot tell.
+	CUDAVersion string
+}
+
+// NewDevice returns the backend named by backend. The scenario file is only used
+// by the simulated backend; the nvml backend needs a binary built with cgo.
+func NewDevice(backend, scenario string) (Device, error) {
+	switch backend {
+	case BackendNVML, "":
+		return newNVMLDevice()
+	case BackendSimulated:
+		s, err := LoadScenario(scenario)
+		if err != nil {
+			return nil, err
 		}
-		usageMap[int(info.Pid)].GPUCore = float64(info.SmUtil)
+		return NewSimulatedDevice(s), nil
 	}
-	return usageMap, nil
+	return nil, fmt.Errorf("unknown gpu backend %q", backend)
 }
 
-func (device *DeviceImpl) getPidUsage(pid int) (*process.ProcessUsage, error) {
-	nvml.Init()
-	defer nvml.Shutdown()
-	num, err := nvml.DeviceGetCount()
+// Pids returns the pids of the processes running on any card of device.
+func Pids(device Device) ([]int, error) {
+	count, err := device.GetDeviceCount()
 	if err != nil {
 		return nil, err
 	}
-	var usedMemory float64
-	var usedCore float64
-
-	for i := 0; i < int(num); i++ {
-		dev, _ := nvml.DeviceGetHandleByIndex(uint(i))
-		processOnDevices, err := dev.DeviceGetComputeRunningProcesses(1024)
-		if err != nil {
-			klog.Warningf("Can't get processes info from device %d, error %s", uint(i), err)
-			return nil, err
-		}
-		for _, info := range processOnDevices {
-			if int(info.Pid) == pid {
-				usedMemory = float64(info.UsedGPUMemory >> 20)
-			}
-		}
-		processUtilizations, err := dev.DeviceGetProcessUtilization(1024, time.Second)
+	seen := make(map[int]struct{})
+	var pids []int
+	for i := 0; i < count; i++ {
+		cardPids, err := device.GetDevicePids(i)
 		if err != nil {
-			klog.Warningf("Can't get processes utilization from device %d, error %s", uint(i), err)
 			return nil, err
 		}
-		for _, info := range processUtilizations {
-			if int(info.Pid) == pid {
-				usedCore = float64(info.SmUtil)
+		for _, pid := range cardPids {
+			if _, ok := seen[pid]; !ok {
+				seen[pid] = struct{}{}
+				pids = append(pids, pid)
 			}
 		}
-		return &process.ProcessUsage{
-			GPUMem:   usedMemory,
-			GPUCore:   usedCore,
-		}, nil
 	}
-	return nil, err
-}
\ No newline at end of file
+	return pids, nil
+}
@@ -0,0 +1,10 @@
+//go:build !cgo
+// +build !cgo
+
+package nvidia
+
+import "errors"
+
+func newNVMLDevice() (Device, error) {
+	return nil, errors.New("the nvml backend needs a binary built with cgo, use the simulated backend")
+}
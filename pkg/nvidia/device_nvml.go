@@ -0,0 +1,250 @@
+//go:build cgo
+// +build cgo
+
+package nvidia
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	"k8s.io/klog"
+	process "nano-gpu-exporter/pkg/ptree"
+)
+
+// DeviceImpl reads the cards through NVML, sharing one Session between all calls.
+type DeviceImpl struct {
+	session    *Session
+	lastSeen   *lastSeen
+	violations *violations
+}
+
+func NewNVMLDevice() *DeviceImpl {
+	return &DeviceImpl{
+		session:    NewSession(),
+		lastSeen:   newLastSeen(),
+		violations: newViolations(),
+	}
+}
+
+func newNVMLDevice() (Device, error) {
+	return NewNVMLDevice(), nil
+}
+
+func (device *DeviceImpl) GetDeviceCount() (int, error) {
+	return device.session.Count()
+}
+
+func (device *DeviceImpl) GetDeviceMemory(cardNum int) (uint64, uint64, error) {
+	dev, _, release, err := device.session.Handle(cardNum)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer release()
+	memory, ret := dev.GetMemoryInfo()
+	if err := check(ret); err != nil {
+		return 0, 0, device.session.Check(err)
+	}
+	return memory.Used >> 20, memory.Total >> 20, nil
+}
+
+func (device *DeviceImpl) GetDeviceUtilization(cardNum int) (uint, uint, error) {
+	dev, _, release, err := device.session.Handle(cardNum)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer release()
+	utilization, ret := dev.GetUtilizationRates()
+	if err := check(ret); err != nil {
+		return 0, 0, device.session.Check(err)
+	}
+	return uint(utilization.Gpu), uint(utilization.Memory), nil
+}
+
+func (device *DeviceImpl) GetDevicePids(cardNum int) ([]int, error) {
+	dev, _, release, err := device.session.Handle(cardNum)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	computeProcesses, ret := dev.GetComputeRunningProcesses()
+	if err := check(ret); err != nil {
+		return nil, device.session.Check(err)
+	}
+	graphicsProcesses, ret := dev.GetGraphicsRunningProcesses()
+	if err := check(ret); err != nil && isFatal(err) {
+		return nil, device.session.Check(err)
+	}
+	var pids []int
+	for _, info := range append(computeProcesses, graphicsProcesses...) {
+		pids = append(pids, int(info.Pid))
+	}
+	return pids, nil
+}
+
+// GetDeviceUsage reports the memory of the compute and graphics processes and their
+// SM utilization averaged over every sample since the previous call for the card.
+func (device *DeviceImpl) GetDeviceUsage(cardNum int) (map[int]*process.ProcessUsage, error) {
+	dev, uuid, release, err := device.session.Handle(cardNum)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	computeProcesses, ret := dev.GetComputeRunningProcesses()
+	if err := check(ret); err != nil {
+		klog.Warningf("Can't get processes info from device %d, error %s", uint(cardNum), err)
+		return nil, device.session.Check(err)
+	}
+	usageMap := make(map[int]*process.ProcessUsage)
+	addProcesses(usageMap, processMemory(computeProcesses), process.ContextCompute)
+	graphicsProcesses, ret := dev.GetGraphicsRunningProcesses()
+	if err := check(ret); err != nil {
+		// cards without graphics support answer with an error here
+		klog.V(4).Infof("Can't get graphics processes from device %d, error %s", uint(cardNum), err)
+		if isFatal(err) {
+			return nil, device.session.Check(err)
+		}
+	} else {
+		addProcesses(usageMap, processMemory(graphicsProcesses), process.ContextGraphics)
+	}
+	for _, info := range append(computeProcesses, graphicsProcesses...) {
+		if slice := processSlice(info); slice != nil {
+			usageMap[int(info.Pid)].MIG = slice
+		}
+	}
+	markMPSClients(usageMap, func(pid int) string {
+		name, _ := nvml.SystemGetProcessName(pid)
+		return name
+	})
+	now := time.Now()
+	start := device.lastSeen.windowStart(uuid, now)
+	processUtilization, ret := dev.GetProcessUtilization(start)
+	if err := check(ret); err != nil && ret != nvml.ERROR_NOT_FOUND {
+		// cards in MIG mode do not sample the utilization of processes
+		if ret != nvml.ERROR_NOT_SUPPORTED || !migMode(dev) {
+			klog.Warningf("Can't get processes utilization from device %d, error %s", uint(cardNum), err)
+			return nil, device.session.Check(err)
+		}
+	}
+	samples := make([]ProcessSample, 0, len(processUtilization))
+	for _, info := range processUtilization {
+		samples = append(samples, ProcessSample{
+			Pid:       int(info.Pid),
+			TimeStamp: info.TimeStamp,
+			SM:        uint(info.SmUtil),
+			Mem:       uint(info.MemUtil),
+			Enc:       uint(info.EncUtil),
+			Dec:       uint(info.DecUtil),
+		})
+	}
+	end := toMicro(now)
+	averages := averageUtilization(samples, start, end)
+	device.lastSeen.update(uuid, end)
+	for pid, average := range averages {
+		_, exit := usageMap[pid]
+		if !exit {
+			usageMap[pid] = new(process.ProcessUsage)
+		}
+		usageMap[pid].GPUCore = average.SM
+		usageMap[pid].GPUEnc = average.Enc
+		usageMap[pid].GPUDec = average.Dec
+		usageMap[pid].GPUMemBandwidth = average.Mem
+	}
+	return usageMap, nil
+}
+
+func (device *DeviceImpl) GetDeviceInfo(cardNum int) (*DeviceInfo, error) {
+	dev, uuid, release, err := device.session.Handle(cardNum)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	name, ret := dev.GetName()
+	if err := check(ret); err != nil {
+		return nil, device.session.Check(err)
+	}
+	pci, ret := dev.GetPciInfo()
+	if err := check(ret); err != nil {
+		return nil, device.session.Check(err)
+	}
+	vbios, ret := dev.GetVbiosVersion()
+	if err := check(ret); err != nil {
+		return nil, device.session.Check(err)
+	}
+	memory, ret := dev.GetMemoryInfo()
+	if err := check(ret); err != nil {
+		return nil, device.session.Check(err)
+	}
+	minor, ret := dev.GetMinorNumber()
+	if err := check(ret); err != nil {
+		return nil, device.session.Check(err)
+	}
+	return &DeviceInfo{
+		UUID:        uuid,
+		Model:       name,
+		PCIBusID:    busID(pci),
+		VBIOS:       vbios,
+		MemoryTotal: memory.Total >> 20,
+		Minor:       minor,
+	}, nil
+}
+
+func (device *DeviceImpl) GetSystemInfo() (*SystemInfo, error) {
+	release, err := device.session.Acquire()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	driver, ret := nvml.SystemGetDriverVersion()
+	if err := check(ret); err != nil {
+		return nil, device.session.Check(err)
+	}
+	info := &SystemInfo{DriverVersion: driver}
+	cuda, ret := nvml.SystemGetCudaDriverVersion()
+	if err := check(ret); err != nil {
+		if isFatal(err) {
+			return nil, device.session.Check(err)
+		}
+		klog.V(4).Infof("Can't get the cuda version of the driver: %v", err)
+	} else {
+		info.CUDAVersion = cudaVersion(cuda)
+	}
+	return info, nil
+}
+
+// cudaVersion formats a CUDA version as NVML reports it, 1000 * major + 10 * minor,
+// e.g. 11040 is 11.4.
+func cudaVersion(version int) string {
+	return fmt.Sprintf("%d.%d", version/1000, version%1000/10)
+}
+
+func processMemory(infos []nvml.ProcessInfo) []ProcessMemory {
+	list := make([]ProcessMemory, 0, len(infos))
+	for _, info := range infos {
+		list = append(list, ProcessMemory{
+			Pid: int(info.Pid),
+			Mem: info.UsedGpuMemory >> 20,
+		})
+	}
+	return list
+}
+
+// busID reads the NUL terminated PCI bus ID of a card.
+func busID(pci nvml.PciInfo) string {
+	id := make([]byte, 0, len(pci.BusId))
+	for _, c := range pci.BusId {
+		if c == 0 {
+			break
+		}
+		id = append(id, byte(c))
+	}
+	return string(id)
+}
+
+func (device *DeviceImpl) Reinits() (uint64, time.Time) {
+	return device.session.Reinits()
+}
+
+func (device *DeviceImpl) Close() error {
+	return device.session.Close()
+}
@@ -0,0 +1,18 @@
+//go:build cgo
+// +build cgo
+
+package nvidia
+
+import "testing"
+
+func TestCUDAVersion(t *testing.T) {
+	for version, want := range map[int]string{
+		10020: "10.2",
+		11040: "11.4",
+		12000: "12.0",
+	} {
+		if got := cudaVersion(version); got != want {
+			t.Errorf("cudaVersion(%d) = %q, want %q", version, got, want)
+		}
+	}
+}
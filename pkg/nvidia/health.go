@@ -0,0 +1,260 @@
+package nvidia
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"k8s.io/klog"
+	"nano-gpu-exporter/pkg/util"
+)
+
+// Kinds of hardware fault events.
+const (
+	EventXID          = "xid"
+	EventDoubleBitECC = "double_bit_ecc"
+)
+
+// eventWait is how long one wait for a fault event blocks.
+const eventWait = 5 * time.Second
+
+// applicationXIDs are XID errors caused by the application rather than the card,
+// they do not make a card unhealthy.
+var applicationXIDs = map[uint64]struct{}{
+	13: {}, // graphics engine exception
+	31: {}, // GPU memory page fault
+	43: {}, // GPU stopped processing
+	45: {}, // preemptive cleanup, due to previous errors
+	68: {}, // video processor exception
+}
+
+// Event is a hardware fault reported by the driver. Data is the XID of XID events.
+type Event struct {
+	UUID string
+	Type string
+	Data uint64
+}
+
+// HealthCounters are the fault counters of a card read by polling. The ECC, page
+// retirement and row remapping fields are only meaningful when the card supports
+// them; cards with row remapping (Ampere and later) do not retire pages.
+type HealthCounters struct {
+	UUID                      string
+	ECCSupported              bool
+	ECCCorrected              uint64
+	ECCUncorrected            uint64
+	RetiredPagesSupported     bool
+	RetiredPagesSBE           uint64
+	RetiredPagesDBE           uint64
+	RetiredPagesPending       bool
+	RowRemappingSupported     bool
+	RemappedRowsCorrectable   uint64
+	RemappedRowsUncorrectable uint64
+	RowRemappingPending       bool
+	RowRemappingFailed        bool
+}
+
+// CardHealth is the health state of one card. XID and double bit ECC events make a
+// card unhealthy until the exporter restarts, the polled counters only while they
+// show a problem.
+type CardHealth struct {
+	UUID                      string    `json:"uuid"`
+	Index                     int       `json:"index"`
+	Healthy                   bool      `json:"healthy"`
+	Reasons                   []string  `json:"reasons,omitempty"`
+	XIDErrors                 uint64    `json:"xidErrors"`
+	LastXID                   uint64    `json:"lastXid,omitempty"`
+	DoubleBitEvents           uint64    `json:"doubleBitEvents"`
+	ECCSupported              bool      `json:"eccSupported"`
+	ECCCorrected              uint64    `json:"eccCorrected"`
+	ECCUncorrected            uint64    `json:"eccUncorrected"`
+	RetiredPagesSupported     bool      `json:"retiredPagesSupported"`
+	RetiredPagesSBE           uint64    `json:"retiredPagesSbe"`
+	RetiredPagesDBE           uint64    `json:"retiredPagesDbe"`
+	RetiredPagesPending       bool      `json:"retiredPagesPending"`
+	RowRemappingSupported     bool      `json:"rowRemappingSupported"`
+	RemappedRowsCorrectable   uint64    `json:"remappedRowsCorrectable"`
+	RemappedRowsUncorrectable uint64    `json:"remappedRowsUncorrectable"`
+	RowRemappingPending       bool      `json:"rowRemappingPending"`
+	RowRemappingFailed        bool      `json:"rowRemappingFailed"`
+	UpdatedAt                 time.Time `json:"updatedAt"`
+
+	fatalEvents []string
+}
+
+// HealthMonitor watches the fault events of all cards and polls their fault
+// counters, keeping a health state per card.
+type HealthMonitor struct {
+	device   Device
+	interval time.Duration
+	mu       sync.Mutex
+	cards    map[string]*CardHealth
+}
+
+func NewHealthMonitor(device Device, interval time.Duration) *HealthMonitor {
+	return &HealthMonitor{
+		device:   device,
+		interval: interval,
+		mu:       sync.Mutex{},
+		cards:    make(map[string]*CardHealth),
+	}
+}
+
+func (m *HealthMonitor) Run(stop <-chan struct{}) {
+	klog.Info("HealthMonitor run")
+	go m.watchEvents(stop)
+	m.poll()
+	util.Loop(m.poll, m.interval, stop)
+}
+
+// Health returns the health of the card with uuid.
+func (m *HealthMonitor) Health(uuid string) (CardHealth, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	card, ok := m.cards[uuid]
+	if !ok {
+		return CardHealth{}, false
+	}
+	return *card, true
+}
+
+// Snapshot returns the health of all cards ordered by index.
+func (m *HealthMonitor) Snapshot() []CardHealth {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cards := make([]CardHealth, 0, len(m.cards))
+	for _, card := range m.cards {
+		cards = append(cards, *card)
+	}
+	sort.Slice(cards, func(i, j int) bool { return cards[i].Index < cards[j].Index })
+	return cards
+}
+
+// ServeHTTP writes the health of all cards as JSON, with status 503 when one of
+// them is unhealthy.
+func (m *HealthMonitor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	cards := m.Snapshot()
+	status := http.StatusOK
+	for _, card := range cards {
+		if !card.Healthy {
+			status = http.StatusServiceUnavailable
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(cards); err != nil {
+		klog.Errorf("Cannot write gpu health: %v", err)
+	}
+}
+
+func (m *HealthMonitor) poll() {
+	count, err := m.device.GetDeviceCount()
+	if err != nil {
+		klog.Errorf("Cannot get device count: %v", err)
+		return
+	}
+	for i := 0; i < count; i++ {
+		counters, err := m.device.GetDeviceHealth(i)
+		if err != nil {
+			klog.Errorf("Cannot get health of GPU %d: %v", i, err)
+			continue
+		}
+		m.mu.Lock()
+		card := m.card(counters.UUID)
+		card.Index = i
+		card.ECCSupported = counters.ECCSupported
+		card.ECCCorrected = counters.ECCCorrected
+		card.ECCUncorrected = counters.ECCUncorrected
+		card.RetiredPagesSupported = counters.RetiredPagesSupported
+		card.RetiredPagesSBE = counters.RetiredPagesSBE
+		card.RetiredPagesDBE = counters.RetiredPagesDBE
+		card.RetiredPagesPending = counters.RetiredPagesPending
+		card.RowRemappingSupported = counters.RowRemappingSupported
+		card.RemappedRowsCorrectable = counters.RemappedRowsCorrectable
+		card.RemappedRowsUncorrectable = counters.RemappedRowsUncorrectable
+		card.RowRemappingPending = counters.RowRemappingPending
+		card.RowRemappingFailed = counters.RowRemappingFailed
+		card.evaluate()
+		m.mu.Unlock()
+	}
+}
+
+func (m *HealthMonitor) watchEvents(stop <-chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		event, err := m.device.WaitEvent(eventWait)
+		if err != nil {
+			klog.Errorf("Cannot wait for gpu events: %v", err)
+			time.Sleep(m.interval)
+			continue
+		}
+		if event != nil {
+			m.record(event)
+		}
+	}
+}
+
+func (m *HealthMonitor) record(event *Event) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	card := m.card(event.UUID)
+	switch event.Type {
+	case EventXID:
+		card.XIDErrors++
+		card.LastXID = event.Data
+		if _, ok := applicationXIDs[event.Data]; !ok {
+			card.addFatal(fmt.Sprintf("xid %d", event.Data))
+		}
+		klog.Warningf("GPU %s reported xid %d", event.UUID, event.Data)
+	case EventDoubleBitECC:
+		card.DoubleBitEvents++
+		card.addFatal("double bit ecc error")
+		klog.Warningf("GPU %s reported a double bit ecc error", event.UUID)
+	}
+	card.evaluate()
+}
+
+// card returns the state of uuid, m.mu must be held.
+func (m *HealthMonitor) card(uuid string) *CardHealth {
+	card, ok := m.cards[uuid]
+	if !ok {
+		card = &CardHealth{UUID: uuid, Index: -1, Healthy: true}
+		m.cards[uuid] = card
+	}
+	return card
+}
+
+func (card *CardHealth) addFatal(reason string) {
+	for _, known := range card.fatalEvents {
+		if known == reason {
+			return
+		}
+	}
+	card.fatalEvents = append(card.fatalEvents, reason)
+}
+
+func (card *CardHealth) evaluate() {
+	reasons := append([]string{}, card.fatalEvents...)
+	if card.ECCUncorrected > 0 {
+		reasons = append(reasons, "uncorrectable ecc errors")
+	}
+	if card.RetiredPagesPending {
+		reasons = append(reasons, "retired pages pending")
+	}
+	if card.RowRemappingPending {
+		reasons = append(reasons, "row remapping pending")
+	}
+	if card.RowRemappingFailed {
+		reasons = append(reasons, "row remapping failed")
+	}
+	card.Reasons = reasons
+	card.Healthy = len(reasons) == 0
+	card.UpdatedAt = time.Now()
+}
@@ -0,0 +1,88 @@
+//go:build cgo
+// +build cgo
+
+package nvidia
+
+import (
+	"time"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+)
+
+// GetDeviceHealth reads the volatile ECC counters, the retired pages and the
+// remapped rows of a card.
+func (device *DeviceImpl) GetDeviceHealth(cardNum int) (*HealthCounters, error) {
+	dev, uuid, release, err := device.session.Handle(cardNum)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	counters := &HealthCounters{UUID: uuid}
+	corrected, ret := dev.GetTotalEccErrors(nvml.MEMORY_ERROR_TYPE_CORRECTED, nvml.VOLATILE_ECC)
+	if err := check(ret); err == nil {
+		uncorrected, ret := dev.GetTotalEccErrors(nvml.MEMORY_ERROR_TYPE_UNCORRECTED, nvml.VOLATILE_ECC)
+		if err := check(ret); err != nil {
+			return nil, device.session.Check(err)
+		}
+		counters.ECCSupported = true
+		counters.ECCCorrected, counters.ECCUncorrected = corrected, uncorrected
+	} else if isFatal(err) {
+		return nil, device.session.Check(err)
+	}
+	sbe, ret := dev.GetRetiredPages(nvml.PAGE_RETIREMENT_CAUSE_MULTIPLE_SINGLE_BIT_ECC_ERRORS)
+	if err := check(ret); err == nil {
+		dbe, ret := dev.GetRetiredPages(nvml.PAGE_RETIREMENT_CAUSE_DOUBLE_BIT_ECC_ERROR)
+		if err := check(ret); err != nil {
+			return nil, device.session.Check(err)
+		}
+		pending, ret := dev.GetRetiredPagesPendingStatus()
+		if err := check(ret); err != nil {
+			return nil, device.session.Check(err)
+		}
+		counters.RetiredPagesSupported = true
+		counters.RetiredPagesSBE, counters.RetiredPagesDBE = uint64(len(sbe)), uint64(len(dbe))
+		counters.RetiredPagesPending = pending == nvml.FEATURE_ENABLED
+	} else if isFatal(err) {
+		return nil, device.session.Check(err)
+	}
+	correctable, uncorrectable, pending, failed, ret := dev.GetRemappedRows()
+	if err := check(ret); err == nil {
+		counters.RowRemappingSupported = true
+		counters.RemappedRowsCorrectable, counters.RemappedRowsUncorrectable = uint64(correctable), uint64(uncorrectable)
+		counters.RowRemappingPending, counters.RowRemappingFailed = pending, failed
+	} else if isFatal(err) {
+		return nil, device.session.Check(err)
+	}
+	return counters, nil
+}
+
+// WaitEvent waits up to timeout for an XID or double bit ECC event of any card. It
+// returns nil without error when no event came.
+func (device *DeviceImpl) WaitEvent(timeout time.Duration) (*Event, error) {
+	set, release, err := device.session.EventSet()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	data, ret := set.Wait(uint32(timeout / time.Millisecond))
+	if ret == nvml.ERROR_TIMEOUT {
+		return nil, nil
+	}
+	if err := check(ret); err != nil {
+		return nil, device.session.Check(err)
+	}
+	uuid, ret := data.Device.GetUUID()
+	if err := check(ret); err != nil {
+		return nil, device.session.Check(err)
+	}
+	event := &Event{UUID: uuid, Data: data.EventData}
+	switch data.EventType {
+	case nvml.EventTypeXidCriticalError:
+		event.Type = EventXID
+	case nvml.EventTypeDoubleBitEccError:
+		event.Type = EventDoubleBitECC
+	default:
+		return nil, nil
+	}
+	return event, nil
+}
@@ -0,0 +1,73 @@
+package nvidia
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHealthMonitorPollsRowRemapping(t *testing.T) {
+	device := NewSimulatedDevice(&Scenario{Cards: []SimCard{
+		{MemoryTotal: 15109, Health: SimHealth{RetiredPagesSBE: 2}},
+		{MemoryTotal: 40536, Health: SimHealth{RemappedRowsCorrectable: 3}},
+		{MemoryTotal: 40536, Health: SimHealth{RemappedRowsUncorrectable: 1, RowRemappingPending: true}},
+	}})
+	monitor := NewHealthMonitor(device, time.Minute)
+	monitor.poll()
+	cards := monitor.Snapshot()
+	if len(cards) != 3 {
+		t.Fatalf("health of %d cards, want 3", len(cards))
+	}
+	if card := cards[0]; !card.Healthy || !card.RetiredPagesSupported || card.RowRemappingSupported {
+		t.Errorf("card retiring pages = %+v", card)
+	}
+	if card := cards[1]; !card.Healthy || card.RetiredPagesSupported || card.RemappedRowsCorrectable != 3 {
+		t.Errorf("card with remapped rows = %+v", card)
+	}
+	card := cards[2]
+	if card.Healthy || len(card.Reasons) != 1 || card.Reasons[0] != "row remapping pending" {
+		t.Errorf("card with row remapping pending = %+v", card)
+	}
+}
+
+// lostDevice is a simulated card whose fault counters cannot be read until
+// failures reads failed.
+type lostDevice struct {
+	*SimulatedDevice
+	failures int
+}
+
+func (d *lostDevice) GetDeviceHealth(cardNum int) (*HealthCounters, error) {
+	if d.failures > 0 {
+		d.failures--
+		return nil, errors.New("nvml: gpu is lost")
+	}
+	return d.SimulatedDevice.GetDeviceHealth(cardNum)
+}
+
+func TestHealthMonitorServesSwitchAndRecovery(t *testing.T) {
+	scenario := &Scenario{Cards: []SimCard{{MemoryTotal: 40536, Health: SimHealth{RowRemappingPending: true}}}}
+	monitor := NewHealthMonitor(&lostDevice{SimulatedDevice: NewSimulatedDevice(scenario), failures: 2}, time.Minute)
+	status := func() int {
+		recorder := httptest.NewRecorder()
+		monitor.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/healthz/gpus", nil))
+		return recorder.Code
+	}
+	for i := 0; i < 2; i++ {
+		monitor.poll()
+		if code := status(); code != http.StatusOK || len(monitor.Snapshot()) != 0 {
+			t.Fatalf("failed read %d: status %d with %d cards, want 200 with none", i, code, len(monitor.Snapshot()))
+		}
+	}
+	monitor.poll()
+	if code := status(); code != http.StatusServiceUnavailable {
+		t.Errorf("status with row remapping pending = %d, want 503", code)
+	}
+	scenario.Cards[0].Health.RowRemappingPending = false
+	monitor.poll()
+	if code := status(); code != http.StatusOK {
+		t.Errorf("status once the rows are remapped = %d, want 200", code)
+	}
+}
@@ -0,0 +1,20 @@
+package nvidia
+
+import (
+	process "nano-gpu-exporter/pkg/ptree"
+)
+
+// MIGDevice is one compute instance of a card in MIG mode. Compute instances of the
+// same GPU instance share its memory, so they report the same memory figures.
+type MIGDevice struct {
+	UUID  string
+	Slice process.MIGSlice
+	// Profile is the GPU instance profile, e.g. 1g.5gb.
+	Profile string
+	// MemoryUsed and MemoryTotal are in MiB.
+	MemoryUsed  uint64
+	MemoryTotal uint64
+	// CoreSampled is set when the backend samples the utilization of the processes
+	// in the device, NVML does not in MIG mode.
+	CoreSampled bool
+}
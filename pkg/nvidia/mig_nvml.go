@@ -0,0 +1,149 @@
+//go:build cgo
+// +build cgo
+
+package nvidia
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	"k8s.io/klog"
+	process "nano-gpu-exporter/pkg/ptree"
+)
+
+// noInstance is the GPU or compute instance ID NVML reports for a process outside
+// MIG mode.
+const noInstance = 0xFFFFFFFF
+
+// GetMIGDevices returns the MIG devices of a card, none when MIG mode is off. NVML
+// does not sample the utilization of processes in MIG mode, so the core usage of
+// the devices is unknown.
+func (device *DeviceImpl) GetMIGDevices(cardNum int) ([]MIGDevice, error) {
+	dev, _, release, err := device.session.Handle(cardNum)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	if on, err := migEnabled(dev); err != nil || !on {
+		return nil, device.session.Check(err)
+	}
+	memory, ret := dev.GetMemoryInfo()
+	if err := check(ret); err != nil {
+		return nil, device.session.Check(err)
+	}
+	count, ret := dev.GetMaxMigDeviceCount()
+	if err := check(ret); err != nil {
+		return nil, device.session.Check(err)
+	}
+	profiles := make(map[int]string)
+	var devices []MIGDevice
+	for i := 0; i < count; i++ {
+		mig, ret := dev.GetMigDeviceHandleByIndex(i)
+		if ret == nvml.ERROR_NOT_FOUND {
+			continue
+		}
+		if err := check(ret); err != nil {
+			return nil, device.session.Check(err)
+		}
+		migDevice, err := readMIGDevice(mig)
+		if err != nil {
+			return nil, device.session.Check(err)
+		}
+		profile, ok := profiles[migDevice.Slice.GPUInstance]
+		if !ok {
+			profile = instanceProfile(dev, migDevice.Slice.GPUInstance, memory.Total)
+			profiles[migDevice.Slice.GPUInstance] = profile
+		}
+		migDevice.Profile = profile
+		devices = append(devices, migDevice)
+	}
+	return devices, nil
+}
+
+// migEnabled tells whether the card runs in MIG mode, cards without MIG support
+// do not.
+func migEnabled(dev nvml.Device) (bool, error) {
+	current, _, ret := dev.GetMigMode()
+	if ret == nvml.ERROR_NOT_SUPPORTED {
+		return false, nil
+	}
+	if err := check(ret); err != nil {
+		return false, err
+	}
+	return current == nvml.DEVICE_MIG_ENABLE, nil
+}
+
+// migMode tells whether the card runs in MIG mode, taking errors for no.
+func migMode(dev nvml.Device) bool {
+	on, _ := migEnabled(dev)
+	return on
+}
+
+// readMIGDevice reads the instances, UUID and memory of a MIG device handle.
+func readMIGDevice(mig nvml.Device) (MIGDevice, error) {
+	gpuInstance, ret := mig.GetGpuInstanceId()
+	if err := check(ret); err != nil {
+		return MIGDevice{}, err
+	}
+	computeInstance, ret := mig.GetComputeInstanceId()
+	if err := check(ret); err != nil {
+		return MIGDevice{}, err
+	}
+	uuid, ret := mig.GetUUID()
+	if err := check(ret); err != nil {
+		return MIGDevice{}, err
+	}
+	memory, ret := mig.GetMemoryInfo()
+	if err := check(ret); err != nil {
+		return MIGDevice{}, err
+	}
+	return MIGDevice{
+		UUID:        uuid,
+		Slice:       process.MIGSlice{GPUInstance: gpuInstance, ComputeInstance: computeInstance},
+		MemoryUsed:  memory.Used >> 20,
+		MemoryTotal: memory.Total >> 20,
+	}, nil
+}
+
+// instanceProfile names the profile of a GPU instance, e.g. 3g.20gb. Reading GPU
+// instances needs root, without it the profile is left empty.
+func instanceProfile(dev nvml.Device, gpuInstance int, memoryTotal uint64) string {
+	instance, ret := dev.GetGpuInstanceById(gpuInstance)
+	if err := check(ret); err != nil {
+		klog.V(4).Infof("Can't get gpu instance %d: %v", gpuInstance, err)
+		return ""
+	}
+	info, ret := instance.GetInfo()
+	if err := check(ret); err != nil {
+		klog.V(4).Infof("Can't get the info of gpu instance %d: %v", gpuInstance, err)
+		return ""
+	}
+	for profile := 0; profile < nvml.GPU_INSTANCE_PROFILE_COUNT; profile++ {
+		profileInfo, ret := dev.GetGpuInstanceProfileInfo(profile)
+		if ret != nvml.SUCCESS || profileInfo.Id != info.ProfileId {
+			continue
+		}
+		return profileName(profileInfo.SliceCount, profileInfo.MemorySizeMB, memoryTotal)
+	}
+	return ""
+}
+
+// profileName names a GPU instance profile the way nvidia-smi does: the memory of
+// the profile is rounded up to eighths of the card, in GB of the card memory
+// rounded up, so 4864 MB of a 40 GB card is 5gb.
+func profileName(slices uint32, memoryMB uint64, memoryTotal uint64) string {
+	const gb = 1 << 30
+	fraction := float64(memoryMB<<20) / float64(memoryTotal)
+	fraction = math.Ceil(fraction*8) / 8
+	memoryGB := math.Round(fraction * math.Ceil(float64(memoryTotal)/gb))
+	return fmt.Sprintf("%dg.%dgb", slices, int(memoryGB))
+}
+
+// processSlice returns the MIG device a process runs in, nil outside MIG mode.
+func processSlice(info nvml.ProcessInfo) *process.MIGSlice {
+	if info.GpuInstanceId == noInstance || info.ComputeInstanceId == noInstance {
+		return nil
+	}
+	return &process.MIGSlice{GPUInstance: int(info.GpuInstanceId), ComputeInstance: int(info.ComputeInstanceId)}
+}
@@ -0,0 +1,27 @@
+//go:build cgo
+// +build cgo
+
+package nvidia
+
+import "testing"
+
+func TestProfileName(t *testing.T) {
+	const a100, a100x80 = 40536 << 20, 81920 << 20
+	for _, tc := range []struct {
+		slices      uint32
+		memoryMB    uint64
+		memoryTotal uint64
+		want        string
+	}{
+		{slices: 1, memoryMB: 4864, memoryTotal: a100, want: "1g.5gb"},
+		{slices: 2, memoryMB: 9856, memoryTotal: a100, want: "2g.10gb"},
+		{slices: 3, memoryMB: 19968, memoryTotal: a100, want: "3g.20gb"},
+		{slices: 7, memoryMB: 40192, memoryTotal: a100, want: "7g.40gb"},
+		{slices: 1, memoryMB: 9856, memoryTotal: a100x80, want: "1g.10gb"},
+		{slices: 7, memoryMB: 80896, memoryTotal: a100x80, want: "7g.80gb"},
+	} {
+		if got := profileName(tc.slices, tc.memoryMB, tc.memoryTotal); got != tc.want {
+			t.Errorf("profileName(%d, %d, %d) = %q, want %q", tc.slices, tc.memoryMB, tc.memoryTotal, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package nvidia
+
+import (
+	process "nano-gpu-exporter/pkg/ptree"
+)
+
+// mpsServer is the process name of the MPS control daemon's server.
+const mpsServer = "nvidia-cuda-mps-server"
+
+// ProcessMemory is the memory in MiB one process uses on a card.
+type ProcessMemory struct {
+	Pid int
+	Mem uint64
+}
+
+// addProcesses adds the processes of one context kind to usageMap. Entries of the
+// same pid within a list are separate contexts and add up; a pid already seen in
+// another list holds both kinds of context, which NVML reports with the same
+// memory, so the larger value is kept.
+func addProcesses(usageMap map[int]*process.ProcessUsage, infos []ProcessMemory, context string) {
+	mem := make(map[int]uint64)
+	for _, info := range infos {
+		mem[info.Pid] += info.Mem
+	}
+	for pid, used := range mem {
+		usage, ok := usageMap[pid]
+		if !ok {
+			usageMap[pid] = &process.ProcessUsage{
+				GPUMem:  float64(used),
+				Context: context,
+			}
+			continue
+		}
+		if usage.Context != "" && usage.Context != context {
+			usage.Context = process.ContextMixed
+		} else {
+			usage.Context = context
+		}
+		if float64(used) > usage.GPUMem {
+			usage.GPUMem = float64(used)
+		}
+	}
+}
+
+// markMPSClients labels the compute processes of a card running an MPS server as
+// MPS clients. name returns the process name of a pid.
+func markMPSClients(usageMap map[int]*process.ProcessUsage, name func(pid int) string) {
+	server := -1
+	for pid, usage := range usageMap {
+		if usage.Context == process.ContextCompute && name(pid) == mpsServer {
+			server = pid
+			break
+		}
+	}
+	if server < 0 {
+		return
+	}
+	for pid, usage := range usageMap {
+		if pid != server && usage.Context == process.ContextCompute {
+			usage.Context = process.ContextMPS
+		}
+	}
+}
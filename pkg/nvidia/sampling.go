@@ -0,0 +1,126 @@
+package nvidia
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// firstWindow is how far back the first utilization read of a card looks.
+const firstWindow = time.Second
+
+// ProcessSample is one utilization sample of a process, TimeStamp is in
+// microseconds since the epoch.
+type ProcessSample struct {
+	Pid       int
+	TimeStamp uint64
+	SM        uint
+	Mem       uint
+	Enc       uint
+	Dec       uint
+}
+
+// UtilizationAverage is the time-weighted average utilization of a process over a
+// sampling window, in percent.
+type UtilizationAverage struct {
+	SM  float64
+	Mem float64
+	Enc float64
+	Dec float64
+}
+
+// lastSeen remembers per card where the last window ended.
+type lastSeen struct {
+	mu    sync.Mutex
+	stamp map[string]uint64
+}
+
+func newLastSeen() *lastSeen {
+	return &lastSeen{
+		mu:    sync.Mutex{},
+		stamp: make(map[string]uint64),
+	}
+}
+
+// windowStart returns where the next window of the card begins.
+func (l *lastSeen) windowStart(card string, now time.Time) uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if stamp, ok := l.stamp[card]; ok {
+		return stamp
+	}
+	return toMicro(now.Add(-firstWindow))
+}
+
+func (l *lastSeen) update(card string, stamp uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if stamp > l.stamp[card] {
+		l.stamp[card] = stamp
+	}
+}
+
+// averageUtilization averages the samples of every process over the window from
+// start to end. A sample stands for the time since the previous sample of the card,
+// of any process, but for no more than the sampling period, the shortest time
+// between two samples; a process without sample at some point was idle then. Only
+// samples within the window are used.
+func averageUtilization(samples []ProcessSample, start, end uint64) map[int]*UtilizationAverage {
+	averages := make(map[int]*UtilizationAverage)
+	if end <= start {
+		return averages
+	}
+	var stamps []uint64
+	seen := make(map[uint64]struct{})
+	for _, sample := range samples {
+		if sample.TimeStamp <= start || sample.TimeStamp > end {
+			continue
+		}
+		if _, ok := seen[sample.TimeStamp]; !ok {
+			seen[sample.TimeStamp] = struct{}{}
+			stamps = append(stamps, sample.TimeStamp)
+		}
+	}
+	sort.Slice(stamps, func(i, j int) bool { return stamps[i] < stamps[j] })
+	var period uint64
+	for i := 1; i < len(stamps); i++ {
+		if gap := stamps[i] - stamps[i-1]; period == 0 || gap < period {
+			period = gap
+		}
+	}
+	covers := make(map[uint64]float64, len(stamps))
+	prev := start
+	for _, stamp := range stamps {
+		cover := stamp - prev
+		if period > 0 && cover > period {
+			cover = period
+		}
+		covers[stamp] = float64(cover)
+		prev = stamp
+	}
+	window := float64(end - start)
+	for _, sample := range samples {
+		cover, ok := covers[sample.TimeStamp]
+		if !ok {
+			continue
+		}
+		average, ok := averages[sample.Pid]
+		if !ok {
+			average = &UtilizationAverage{}
+			averages[sample.Pid] = average
+		}
+		average.SM += float64(sample.SM) * cover / window
+		average.Mem += float64(sample.Mem) * cover / window
+		average.Enc += float64(sample.Enc) * cover / window
+		average.Dec += float64(sample.Dec) * cover / window
+	}
+	return averages
+}
+
+func toMicro(t time.Time) uint64 {
+	return uint64(t.UnixNano() / int64(time.Microsecond))
+}
+
+func fromMicro(stamp uint64) time.Time {
+	return time.Unix(0, int64(stamp)*int64(time.Microsecond))
+}
@@ -0,0 +1,79 @@
+package nvidia
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// everySecond returns a sample of pid at each of the seconds, with sm utilization.
+func everySecond(pid int, sm uint, seconds ...int) []ProcessSample {
+	var samples []ProcessSample
+	for _, second := range seconds {
+		samples = append(samples, ProcessSample{
+			Pid:       pid,
+			TimeStamp: uint64(time.Duration(second) * time.Second / time.Microsecond),
+			SM:        sm,
+		})
+	}
+	return samples
+}
+
+func TestAverageUtilization(t *testing.T) {
+	window := uint64(10 * time.Second / time.Microsecond)
+	for _, tc := range []struct {
+		name    string
+		samples []ProcessSample
+		want    map[int]float64
+	}{
+		{
+			name:    "sample every period",
+			samples: everySecond(1, 50, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10),
+			want:    map[int]float64{1: 50},
+		},
+		{
+			// pid 2 only shows up in three of the ten periods of the card
+			name:    "sparse process",
+			samples: append(everySecond(1, 10, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10), everySecond(2, 90, 2, 5, 9)...),
+			want:    map[int]float64{1: 10, 2: 27},
+		},
+		{
+			name:    "idle after the last sample",
+			samples: everySecond(1, 100, 1, 2, 3, 4, 5),
+			want:    map[int]float64{1: 50},
+		},
+		{
+			// the first sample stands for one period, not for the idle time before it
+			name:    "idle before the first sample",
+			samples: everySecond(1, 100, 8, 9, 10),
+			want:    map[int]float64{1: 30},
+		},
+		{
+			name:    "samples outside the window",
+			samples: everySecond(1, 100, 0, 11, 12),
+			want:    map[int]float64{},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			averages := averageUtilization(tc.samples, 0, window)
+			if len(averages) != len(tc.want) {
+				t.Fatalf("averages of %d processes, want %d", len(averages), len(tc.want))
+			}
+			for pid, want := range tc.want {
+				average, ok := averages[pid]
+				if !ok {
+					t.Fatalf("no average of pid %d", pid)
+				}
+				if math.Abs(average.SM-want) > 1e-9 {
+					t.Errorf("sm of pid %d = %v, want %v", pid, average.SM, want)
+				}
+			}
+		})
+	}
+}
+
+func TestAverageUtilizationEmptyWindow(t *testing.T) {
+	if averages := averageUtilization(everySecond(1, 100, 1), 5, 5); len(averages) != 0 {
+		t.Errorf("empty window gave averages %v", averages)
+	}
+}
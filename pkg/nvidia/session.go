@@ -0,0 +1,267 @@
+//go:build cgo
+// +build cgo
+
+package nvidia
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	"k8s.io/klog"
+)
+
+// faultEvents are the event types the health monitor listens to.
+const faultEvents = nvml.EventTypeXidCriticalError | nvml.EventTypeDoubleBitEccError
+
+// fatalErrors are the errors after which the library has to be initialized again
+// before it is usable.
+var fatalErrors = map[nvml.Return]struct{}{
+	nvml.ERROR_GPU_IS_LOST:             {},
+	nvml.ERROR_UNINITIALIZED:           {},
+	nvml.ERROR_DRIVER_NOT_LOADED:       {},
+	nvml.ERROR_RESET_REQUIRED:          {},
+	nvml.ERROR_LIB_RM_VERSION_MISMATCH: {},
+	nvml.ERROR_LIBRARY_NOT_FOUND:       {},
+	nvml.ERROR_UNKNOWN:                 {},
+}
+
+// returnMessages describe the NVML return codes. nvml.ErrorString cannot be used:
+// it calls into the library, which is unloaded once the session is shut down.
+var returnMessages = map[nvml.Return]string{
+	nvml.ERROR_UNINITIALIZED:           "uninitialized",
+	nvml.ERROR_INVALID_ARGUMENT:        "invalid argument",
+	nvml.ERROR_NOT_SUPPORTED:           "not supported",
+	nvml.ERROR_NO_PERMISSION:           "insufficient permissions",
+	nvml.ERROR_NOT_FOUND:               "not found",
+	nvml.ERROR_INSUFFICIENT_SIZE:       "insufficient size",
+	nvml.ERROR_DRIVER_NOT_LOADED:       "driver not loaded",
+	nvml.ERROR_TIMEOUT:                 "timeout",
+	nvml.ERROR_LIBRARY_NOT_FOUND:       "library not found",
+	nvml.ERROR_FUNCTION_NOT_FOUND:      "function not found",
+	nvml.ERROR_GPU_IS_LOST:             "gpu is lost",
+	nvml.ERROR_RESET_REQUIRED:          "gpu requires reset",
+	nvml.ERROR_LIB_RM_VERSION_MISMATCH: "driver/library version mismatch",
+	nvml.ERROR_NO_DATA:                 "no data",
+	nvml.ERROR_UNKNOWN:                 "unknown error",
+}
+
+// nvmlError is the return code of a failed NVML call.
+type nvmlError nvml.Return
+
+func (e nvmlError) Error() string {
+	if msg, ok := returnMessages[nvml.Return(e)]; ok {
+		return "nvml: " + msg
+	}
+	return fmt.Sprintf("nvml: error %d", int32(e))
+}
+
+// check turns the return code of an NVML call into an error, nil on success.
+func check(ret nvml.Return) error {
+	if ret == nvml.SUCCESS {
+		return nil
+	}
+	return nvmlError(ret)
+}
+
+// Session keeps NVML initialized for the life of the exporter. Device handles are
+// looked up once and cached by UUID; a driver error drops the session so the next
+// call initializes the library again.
+//
+// Handles and the event set are only valid between acquiring them and calling
+// release: the session is shut down once no call uses them anymore, so a health
+// monitor waiting for events or a sampler still reading a card never sees them
+// freed underneath.
+type Session struct {
+	mu          sync.Mutex
+	initialized bool
+	everInit    bool
+	uuids       []string
+	handles     map[string]nvml.Device
+	reinits     uint64
+	lastReinit  time.Time
+	eventSet    *nvml.EventSet
+	// inUse is held for reading by every call using the library, and for writing
+	// to shut it down.
+	inUse sync.RWMutex
+	// lost is set when a call failed in a way which needs a new session.
+	lost int32
+}
+
+func NewSession() *Session {
+	return &Session{
+		mu:      sync.Mutex{},
+		handles: make(map[string]nvml.Device),
+	}
+}
+
+func (s *Session) Count() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.ensure(); err != nil {
+		return 0, err
+	}
+	return len(s.uuids), nil
+}
+
+// Acquire keeps the library initialized until release is called.
+func (s *Session) Acquire() (func(), error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.ensure(); err != nil {
+		return nil, err
+	}
+	s.inUse.RLock()
+	return s.inUse.RUnlock, nil
+}
+
+// Handle returns the handle and UUID of the card at index, valid until release is
+// called.
+func (s *Session) Handle(index int) (nvml.Device, string, func(), error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.ensure(); err != nil {
+		return nvml.Device{}, "", nil, err
+	}
+	if index < 0 || index >= len(s.uuids) {
+		return nvml.Device{}, "", nil, fmt.Errorf("no gpu %d", index)
+	}
+	uuid := s.uuids[index]
+	s.inUse.RLock()
+	return s.handles[uuid], uuid, s.inUse.RUnlock, nil
+}
+
+// Check marks the session lost if err means the library or a card went away, and
+// returns err unchanged. The session is shut down by the next call, after the
+// calls in flight released it.
+func (s *Session) Check(err error) error {
+	if err == nil || !isFatal(err) {
+		return err
+	}
+	if atomic.CompareAndSwapInt32(&s.lost, 0, 1) {
+		klog.Warningf("NVML session lost: %v, it will be initialized again", err)
+	}
+	return err
+}
+
+// Reinits returns how many times the library was initialized again after the first
+// time, and when that last happened.
+func (s *Session) Reinits() (uint64, time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.reinits, s.lastReinit
+}
+
+// EventSet returns the event set all cards registered their fault events with,
+// valid until release is called. It is created on first use after every
+// initialization.
+func (s *Session) EventSet() (nvml.EventSet, func(), error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.ensure(); err != nil {
+		return nvml.EventSet{}, nil, err
+	}
+	if s.eventSet == nil {
+		set, ret := nvml.EventSetCreate()
+		if err := check(ret); err != nil {
+			return nvml.EventSet{}, nil, err
+		}
+		for uuid, dev := range s.handles {
+			supported, ret := dev.GetSupportedEventTypes()
+			if err := check(ret); err != nil {
+				klog.Warningf("Can't get supported events of %s: %v", uuid, err)
+				continue
+			}
+			types := supported & faultEvents
+			if types == 0 {
+				continue
+			}
+			if err := check(dev.RegisterEvents(types, set)); err != nil {
+				klog.Warningf("Can't register events of %s: %v", uuid, err)
+			}
+		}
+		s.eventSet = &set
+	}
+	s.inUse.RLock()
+	return *s.eventSet, s.inUse.RUnlock, nil
+}
+
+// Close shuts the library down, waiting for the calls in flight.
+func (s *Session) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.initialized {
+		return nil
+	}
+	return s.shutdown()
+}
+
+func (s *Session) ensure() error {
+	if s.initialized && atomic.LoadInt32(&s.lost) == 1 {
+		s.shutdown()
+	}
+	if s.initialized {
+		return nil
+	}
+	if err := check(nvml.Init()); err != nil {
+		return err
+	}
+	count, ret := nvml.DeviceGetCount()
+	if err := check(ret); err != nil {
+		nvml.Shutdown()
+		return err
+	}
+	uuids := make([]string, 0, count)
+	handles := make(map[string]nvml.Device, count)
+	for i := 0; i < count; i++ {
+		dev, ret := nvml.DeviceGetHandleByIndex(i)
+		if err := check(ret); err != nil {
+			nvml.Shutdown()
+			return err
+		}
+		uuid, ret := dev.GetUUID()
+		if err := check(ret); err != nil {
+			nvml.Shutdown()
+			return err
+		}
+		uuids = append(uuids, uuid)
+		handles[uuid] = dev
+	}
+	s.uuids = uuids
+	s.handles = handles
+	s.initialized = true
+	if s.everInit {
+		s.reinits++
+		s.lastReinit = time.Now()
+		klog.Infof("NVML initialized again, %d gpus found", count)
+	}
+	s.everInit = true
+	return nil
+}
+
+// shutdown waits until no call uses the library, s.mu must be held.
+func (s *Session) shutdown() error {
+	s.inUse.Lock()
+	defer s.inUse.Unlock()
+	atomic.StoreInt32(&s.lost, 0)
+	if s.eventSet != nil {
+		s.eventSet.Free()
+		s.eventSet = nil
+	}
+	s.initialized = false
+	s.uuids = nil
+	s.handles = make(map[string]nvml.Device)
+	return check(nvml.Shutdown())
+}
+
+func isFatal(err error) bool {
+	var ret nvmlError
+	if !errors.As(err, &ret) {
+		return false
+	}
+	_, ok := fatalErrors[nvml.Return(ret)]
+	return ok
+}
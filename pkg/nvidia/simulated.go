@@ -0,0 +1,590 @@
+package nvidia
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	process "nano-gpu-exporter/pkg/ptree"
+	"sigs.k8s.io/yaml"
+)
+
+// Scenario describes the cards and processes served by the simulated backend.
+// It is read from a YAML or JSON file, for example:
+//
+//	cards:
+//	- model: Tesla T4
+//	  memoryTotal: 15109
+//	  processes:
+//	  - pid: 4242
+//	    loop: true
+//	    steps:
+//	    - {duration: 1m, mem: 2048, sm: 40}
+//	    - {duration: 30s, mem: 2048, sm: 0}
+//
+// A card in MIG mode lists its MIG devices, and its processes name the instance
+// they run in:
+//
+//	cards:
+//	- model: A100-SXM4-40GB
+//	  memoryTotal: 40536
+//	  mig:
+//	  - {gpuInstance: 1, computeInstance: 0, profile: 3g.20gb, memoryTotal: 20096}
+//	  - {gpuInstance: 2, computeInstance: 0, profile: 3g.20gb, memoryTotal: 20096}
+//	  processes:
+//	  - pid: 4243
+//	    mig: {gpuInstance: 2, computeInstance: 0}
+//	    steps:
+//	    - {mem: 8192, sm: 70}
+type Scenario struct {
+	DriverVersion string    `json:"driverVersion,omitempty"`
+	CUDAVersion   string    `json:"cudaVersion,omitempty"`
+	Cards         []SimCard `json:"cards"`
+}
+
+// SimCard is a simulated card, UUID and PCIBusID are made up from its index when
+// left empty.
+type SimCard struct {
+	UUID     string `json:"uuid,omitempty"`
+	Model    string `json:"model,omitempty"`
+	PCIBusID string `json:"pciBusId,omitempty"`
+	VBIOS    string `json:"vbios,omitempty"`
+	// MemoryTotal is the card capacity in MiB.
+	MemoryTotal uint64 `json:"memoryTotal"`
+	// MemoryReserved is memory in MiB used on the card but not owned by any process.
+	MemoryReserved uint64    `json:"memoryReserved,omitempty"`
+	Telemetry      Telemetry `json:"telemetry,omitempty"`
+	Health         SimHealth `json:"health,omitempty"`
+	// ThrottleReasons are the clock throttle reasons active on the card.
+	ThrottleReasons []string `json:"throttleReasons,omitempty"`
+	// MIG lists the MIG devices of a card in MIG mode.
+	MIG       []SimMIGDevice `json:"mig,omitempty"`
+	Processes []SimProcess   `json:"processes,omitempty"`
+}
+
+// SimMIGDevice is a compute instance of a simulated card in MIG mode, its UUID is
+// made up from the card UUID and the instances when left empty.
+type SimMIGDevice struct {
+	UUID string `json:"uuid,omitempty"`
+	SimSlice
+	Profile string `json:"profile,omitempty"`
+	// MemoryTotal is the memory of the GPU instance in MiB.
+	MemoryTotal uint64 `json:"memoryTotal"`
+}
+
+type SimSlice struct {
+	GPUInstance     int `json:"gpuInstance"`
+	ComputeInstance int `json:"computeInstance"`
+}
+
+// SimHealth holds the fault counters of a simulated card and the fault events it
+// reports over time. A card with remapped rows, or row remapping pending or failed,
+// uses row remapping and does not retire pages.
+type SimHealth struct {
+	ECCCorrected              uint64     `json:"eccCorrected,omitempty"`
+	ECCUncorrected            uint64     `json:"eccUncorrected,omitempty"`
+	RetiredPagesSBE           uint64     `json:"retiredPagesSbe,omitempty"`
+	RetiredPagesDBE           uint64     `json:"retiredPagesDbe,omitempty"`
+	RetiredPagesPending       bool       `json:"retiredPagesPending,omitempty"`
+	RemappedRowsCorrectable   uint64     `json:"remappedRowsCorrectable,omitempty"`
+	RemappedRowsUncorrectable uint64     `json:"remappedRowsUncorrectable,omitempty"`
+	RowRemappingPending       bool       `json:"rowRemappingPending,omitempty"`
+	RowRemappingFailed        bool       `json:"rowRemappingFailed,omitempty"`
+	Events                    []SimEvent `json:"events,omitempty"`
+}
+
+// SimEvent is a fault event reported At after the scenario began; Type is xid or
+// double_bit_ecc.
+type SimEvent struct {
+	At   metav1.Duration `json:"at"`
+	Type string          `json:"type"`
+	XID  uint64          `json:"xid,omitempty"`
+}
+
+// SimProcess is a process that plays its steps one after another, starting Start
+// after the scenario began. Without Loop it exits once the last step is over; a
+// step without duration lasts forever.
+type SimProcess struct {
+	Pid int `json:"pid"`
+	// Context is the kind of GPU context the process holds, compute by default.
+	Context string `json:"context,omitempty"`
+	// MIG is the MIG device the process runs in, on cards in MIG mode.
+	MIG   *SimSlice       `json:"mig,omitempty"`
+	Start metav1.Duration `json:"start,omitempty"`
+	Loop  bool            `json:"loop,omitempty"`
+	Steps []SimStep       `json:"steps"`
+}
+
+type SimStep struct {
+	Duration metav1.Duration `json:"duration,omitempty"`
+	// Mem is the memory used in MiB.
+	Mem uint64 `json:"mem"`
+	// SM is the SM utilization in percent.
+	SM uint `json:"sm"`
+	// MemUtil is the memory controller utilization in percent.
+	MemUtil uint `json:"memUtil,omitempty"`
+	// Enc and Dec are the encoder and decoder utilization in percent.
+	Enc uint `json:"enc,omitempty"`
+	Dec uint `json:"dec,omitempty"`
+}
+
+func LoadScenario(path string) (*Scenario, error) {
+	if path == "" {
+		return nil, fmt.Errorf("simulated backend needs a scenario file")
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	scenario := &Scenario{}
+	if err := yaml.Unmarshal(data, scenario); err != nil {
+		return nil, fmt.Errorf("cannot parse scenario %s: %v", path, err)
+	}
+	for i, card := range scenario.Cards {
+		if card.MemoryTotal == 0 {
+			return nil, fmt.Errorf("card %d in scenario %s has no memoryTotal", i, path)
+		}
+		slices := make(map[SimSlice]struct{})
+		for _, mig := range card.MIG {
+			slices[mig.SimSlice] = struct{}{}
+		}
+		for _, proc := range card.Processes {
+			if proc.MIG == nil && len(card.MIG) == 0 {
+				continue
+			}
+			if proc.MIG == nil {
+				return nil, fmt.Errorf("process %d on MIG card %d in scenario %s has no mig device", proc.Pid, i, path)
+			}
+			if _, ok := slices[*proc.MIG]; !ok {
+				return nil, fmt.Errorf("process %d on card %d in scenario %s runs in unknown mig device %d/%d",
+					proc.Pid, i, path, proc.MIG.GPUInstance, proc.MIG.ComputeInstance)
+			}
+		}
+	}
+	return scenario, nil
+}
+
+// simSamplePeriod is how often a simulated process reports a utilization sample.
+const simSamplePeriod = time.Second
+
+// SimulatedDevice is a Device which serves a Scenario instead of real hardware.
+type SimulatedDevice struct {
+	scenario *Scenario
+	start    time.Time
+	mu       sync.Mutex
+	now      func() time.Time
+	lastSeen *lastSeen
+	// delivered counts the events of every card already returned by WaitEvent.
+	delivered map[int]int
+	// accounting holds when accounting mode was turned on per card.
+	accounting map[int]time.Time
+}
+
+func NewSimulatedDevice(scenario *Scenario) *SimulatedDevice {
+	return &SimulatedDevice{
+		scenario:   scenario,
+		start:      time.Now().Truncate(time.Microsecond),
+		mu:         sync.Mutex{},
+		now:        time.Now,
+		lastSeen:   newLastSeen(),
+		delivered:  make(map[int]int),
+		accounting: make(map[int]time.Time),
+	}
+}
+
+// SetClock replaces the clock the scenario is played against.
+func (device *SimulatedDevice) SetClock(now func() time.Time) {
+	device.mu.Lock()
+	defer device.mu.Unlock()
+	device.start = now().Truncate(time.Microsecond)
+	device.now = now
+}
+
+func (device *SimulatedDevice) GetDeviceCount() (int, error) {
+	return len(device.scenario.Cards), nil
+}
+
+func (device *SimulatedDevice) GetDeviceMemory(cardNum int) (uint64, uint64, error) {
+	card, err := device.card(cardNum)
+	if err != nil {
+		return 0, 0, err
+	}
+	used := card.MemoryReserved
+	for _, step := range device.steps(card) {
+		used += step.Mem
+	}
+	if used > card.MemoryTotal {
+		used = card.MemoryTotal
+	}
+	return used, card.MemoryTotal, nil
+}
+
+func (device *SimulatedDevice) GetDeviceUtilization(cardNum int) (uint, uint, error) {
+	card, err := device.card(cardNum)
+	if err != nil {
+		return 0, 0, err
+	}
+	var core, mem uint
+	for _, step := range device.steps(card) {
+		core += step.SM
+		mem += step.MemUtil
+	}
+	return capPercent(core), capPercent(mem), nil
+}
+
+func (device *SimulatedDevice) GetDeviceUsage(cardNum int) (map[int]*process.ProcessUsage, error) {
+	card, err := device.card(cardNum)
+	if err != nil {
+		return nil, err
+	}
+	now := device.clock()
+	procs := make(map[int]SimProcess)
+	for _, proc := range card.Processes {
+		if proc.Context == "" {
+			proc.Context = process.ContextCompute
+		}
+		procs[proc.Pid] = proc
+	}
+	usageMap := make(map[int]*process.ProcessUsage)
+	for pid, step := range device.stepsAt(card, now) {
+		usageMap[pid] = &process.ProcessUsage{
+			GPUMem:  float64(step.Mem),
+			Context: procs[pid].Context,
+		}
+		if mig := procs[pid].MIG; mig != nil {
+			usageMap[pid].MIG = &process.MIGSlice{GPUInstance: mig.GPUInstance, ComputeInstance: mig.ComputeInstance}
+		}
+	}
+	key := strconv.Itoa(cardNum)
+	start := device.lastSeen.windowStart(key, now)
+	var samples []ProcessSample
+	for stamp := fromMicro(start).Add(simSamplePeriod); !stamp.After(now); stamp = stamp.Add(simSamplePeriod) {
+		for pid, step := range device.stepsAt(card, stamp) {
+			samples = append(samples, ProcessSample{
+				Pid:       pid,
+				TimeStamp: toMicro(stamp),
+				SM:        step.SM,
+				Mem:       step.MemUtil,
+				Enc:       step.Enc,
+				Dec:       step.Dec,
+			})
+		}
+	}
+	end := toMicro(now)
+	averages := averageUtilization(samples, start, end)
+	device.lastSeen.update(key, end)
+	for pid, average := range averages {
+		if _, ok := usageMap[pid]; !ok {
+			usageMap[pid] = new(process.ProcessUsage)
+		}
+		usageMap[pid].GPUCore = average.SM
+		usageMap[pid].GPUEnc = average.Enc
+		usageMap[pid].GPUDec = average.Dec
+		usageMap[pid].GPUMemBandwidth = average.Mem
+	}
+	return usageMap, nil
+}
+
+func (device *SimulatedDevice) GetDevicePids(cardNum int) ([]int, error) {
+	card, err := device.card(cardNum)
+	if err != nil {
+		return nil, err
+	}
+	var pids []int
+	for pid := range device.steps(card) {
+		pids = append(pids, pid)
+	}
+	return pids, nil
+}
+
+func (device *SimulatedDevice) GetDeviceInfo(cardNum int) (*DeviceInfo, error) {
+	card, err := device.card(cardNum)
+	if err != nil {
+		return nil, err
+	}
+	info := &DeviceInfo{
+		UUID:        card.UUID,
+		Model:       card.Model,
+		PCIBusID:    card.PCIBusID,
+		VBIOS:       card.VBIOS,
+		MemoryTotal: card.MemoryTotal,
+		Minor:       cardNum,
+	}
+	if info.UUID == "" {
+		info.UUID = fmt.Sprintf("GPU-00000000-0000-0000-0000-%012d", cardNum)
+	}
+	if info.PCIBusID == "" {
+		info.PCIBusID = fmt.Sprintf("00000000:%02X:00.0", cardNum+1)
+	}
+	return info, nil
+}
+
+func (device *SimulatedDevice) GetSystemInfo() (*SystemInfo, error) {
+	return &SystemInfo{
+		DriverVersion: device.scenario.DriverVersion,
+		CUDAVersion:   device.scenario.CUDAVersion,
+	}, nil
+}
+
+func (device *SimulatedDevice) GetDeviceTelemetry(cardNum int, groups Groups) (*Telemetry, error) {
+	card, err := device.card(cardNum)
+	if err != nil {
+		return nil, err
+	}
+	return card.Telemetry.filter(groups), nil
+}
+
+func (device *SimulatedDevice) GetDeviceHealth(cardNum int) (*HealthCounters, error) {
+	card, err := device.card(cardNum)
+	if err != nil {
+		return nil, err
+	}
+	info, _ := device.GetDeviceInfo(cardNum)
+	health := card.Health
+	counters := &HealthCounters{
+		UUID:           info.UUID,
+		ECCSupported:   true,
+		ECCCorrected:   health.ECCCorrected,
+		ECCUncorrected: health.ECCUncorrected,
+	}
+	if health.RemappedRowsCorrectable+health.RemappedRowsUncorrectable > 0 || health.RowRemappingPending || health.RowRemappingFailed {
+		counters.RowRemappingSupported = true
+		counters.RemappedRowsCorrectable = health.RemappedRowsCorrectable
+		counters.RemappedRowsUncorrectable = health.RemappedRowsUncorrectable
+		counters.RowRemappingPending = health.RowRemappingPending
+		counters.RowRemappingFailed = health.RowRemappingFailed
+		return counters, nil
+	}
+	counters.RetiredPagesSupported = true
+	counters.RetiredPagesSBE = health.RetiredPagesSBE
+	counters.RetiredPagesDBE = health.RetiredPagesDBE
+	counters.RetiredPagesPending = health.RetiredPagesPending
+	return counters, nil
+}
+
+// WaitEvent returns the next scenario event which is due, events are expected in
+// the order of their At.
+func (device *SimulatedDevice) WaitEvent(timeout time.Duration) (*Event, error) {
+	now := device.clock()
+	device.mu.Lock()
+	elapsed := now.Sub(device.start)
+	wait := timeout
+	for i, card := range device.scenario.Cards {
+		next := device.delivered[i]
+		if next >= len(card.Health.Events) {
+			continue
+		}
+		event := card.Health.Events[next]
+		if event.At.Duration <= elapsed {
+			device.delivered[i]++
+			device.mu.Unlock()
+			info, _ := device.GetDeviceInfo(i)
+			return &Event{UUID: info.UUID, Type: event.Type, Data: event.XID}, nil
+		}
+		if event.At.Duration-elapsed < wait {
+			wait = event.At.Duration - elapsed
+		}
+	}
+	device.mu.Unlock()
+	time.Sleep(wait)
+	return nil, nil
+}
+
+func (device *SimulatedDevice) GetDeviceThrottle(cardNum int) (map[string]bool, error) {
+	card, err := device.card(cardNum)
+	if err != nil {
+		return nil, err
+	}
+	reasons := make(map[string]bool)
+	for _, reason := range ThrottleReasons {
+		reasons[reason] = false
+	}
+	for _, reason := range card.ThrottleReasons {
+		reasons[reason] = true
+	}
+	return reasons, nil
+}
+
+// GetMIGDevices returns the MIG devices of the card, a device uses the memory of
+// the processes running in its GPU instance.
+func (device *SimulatedDevice) GetMIGDevices(cardNum int) ([]MIGDevice, error) {
+	card, err := device.card(cardNum)
+	if err != nil {
+		return nil, err
+	}
+	if len(card.MIG) == 0 {
+		return nil, nil
+	}
+	used := make(map[int]uint64)
+	running := device.steps(card)
+	for _, proc := range card.Processes {
+		if step, ok := running[proc.Pid]; ok && proc.MIG != nil {
+			used[proc.MIG.GPUInstance] += step.Mem
+		}
+	}
+	devices := make([]MIGDevice, 0, len(card.MIG))
+	for _, mig := range card.MIG {
+		migDevice := MIGDevice{
+			UUID:        mig.UUID,
+			Slice:       process.MIGSlice{GPUInstance: mig.GPUInstance, ComputeInstance: mig.ComputeInstance},
+			Profile:     mig.Profile,
+			MemoryUsed:  used[mig.GPUInstance],
+			MemoryTotal: mig.MemoryTotal,
+			CoreSampled: true,
+		}
+		if migDevice.MemoryUsed > migDevice.MemoryTotal {
+			migDevice.MemoryUsed = migDevice.MemoryTotal
+		}
+		if migDevice.UUID == "" {
+			info, _ := device.GetDeviceInfo(cardNum)
+			migDevice.UUID = fmt.Sprintf("MIG-%s/%d/%d", info.UUID, mig.GPUInstance, mig.ComputeInstance)
+		}
+		devices = append(devices, migDevice)
+	}
+	return devices, nil
+}
+
+func (device *SimulatedDevice) EnableAccounting(cardNum int) error {
+	if _, err := device.card(cardNum); err != nil {
+		return err
+	}
+	now := device.clock()
+	device.mu.Lock()
+	defer device.mu.Unlock()
+	if _, ok := device.accounting[cardNum]; !ok {
+		device.accounting[cardNum] = now
+	}
+	return nil
+}
+
+// GetAccountedProcesses returns the processes of the card which played all their
+// steps since accounting mode was turned on.
+func (device *SimulatedDevice) GetAccountedProcesses(cardNum int) ([]AccountedProcess, error) {
+	card, err := device.card(cardNum)
+	if err != nil {
+		return nil, err
+	}
+	now := device.clock()
+	device.mu.Lock()
+	since, ok := device.accounting[cardNum]
+	start := device.start
+	device.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("accounting mode is off on simulated card %d", cardNum)
+	}
+	var finished []AccountedProcess
+	for _, proc := range card.Processes {
+		total, ok := proc.lifetime()
+		if !ok {
+			continue
+		}
+		account := AccountedProcess{
+			Pid:   proc.Pid,
+			Start: start.Add(proc.Start.Duration),
+		}
+		account.End = account.Start.Add(total)
+		if account.End.Before(since) || account.End.After(now) {
+			continue
+		}
+		for _, step := range proc.Steps {
+			share := float64(step.Duration.Duration) / float64(total)
+			account.SM += float64(step.SM) * share
+			account.MemUtil += float64(step.MemUtil) * share
+			if step.Mem > account.MaxMem {
+				account.MaxMem = step.Mem
+			}
+		}
+		finished = append(finished, account)
+	}
+	return finished, nil
+}
+
+func (device *SimulatedDevice) Reinits() (uint64, time.Time) {
+	return 0, time.Time{}
+}
+
+func (device *SimulatedDevice) Close() error {
+	return nil
+}
+
+func (device *SimulatedDevice) card(cardNum int) (*SimCard, error) {
+	if cardNum < 0 || cardNum >= len(device.scenario.Cards) {
+		return nil, fmt.Errorf("no simulated card %d", cardNum)
+	}
+	return &device.scenario.Cards[cardNum], nil
+}
+
+func (device *SimulatedDevice) clock() time.Time {
+	device.mu.Lock()
+	defer device.mu.Unlock()
+	return device.now()
+}
+
+// steps returns the current step of every process running on the card.
+func (device *SimulatedDevice) steps(card *SimCard) map[int]SimStep {
+	return device.stepsAt(card, device.clock())
+}
+
+// stepsAt returns the step every process running on the card is in at t.
+func (device *SimulatedDevice) stepsAt(card *SimCard, t time.Time) map[int]SimStep {
+	device.mu.Lock()
+	elapsed := t.Sub(device.start)
+	device.mu.Unlock()
+	running := make(map[int]SimStep)
+	for _, proc := range card.Processes {
+		if step, ok := proc.stepAt(elapsed); ok {
+			running[proc.Pid] = step
+		}
+	}
+	return running
+}
+
+func (proc *SimProcess) stepAt(elapsed time.Duration) (SimStep, bool) {
+	offset := elapsed - proc.Start.Duration
+	if offset < 0 || len(proc.Steps) == 0 {
+		return SimStep{}, false
+	}
+	var total time.Duration
+	for _, step := range proc.Steps {
+		if step.Duration.Duration <= 0 {
+			total = 0
+			break
+		}
+		total += step.Duration.Duration
+	}
+	if total > 0 && proc.Loop {
+		offset %= total
+	}
+	for _, step := range proc.Steps {
+		if step.Duration.Duration <= 0 || offset < step.Duration.Duration {
+			return step, true
+		}
+		offset -= step.Duration.Duration
+	}
+	return SimStep{}, false
+}
+
+// lifetime returns how long the process runs, false if it never exits.
+func (proc *SimProcess) lifetime() (time.Duration, bool) {
+	if proc.Loop || len(proc.Steps) == 0 {
+		return 0, false
+	}
+	var total time.Duration
+	for _, step := range proc.Steps {
+		if step.Duration.Duration <= 0 {
+			return 0, false
+		}
+		total += step.Duration.Duration
+	}
+	return total, true
+}
+
+func capPercent(value uint) uint {
+	if value > 100 {
+		return 100
+	}
+	return value
+}
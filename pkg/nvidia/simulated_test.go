@@ -0,0 +1,225 @@
+package nvidia
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	process "nano-gpu-exporter/pkg/ptree"
+)
+
+const testScenario = `
+driverVersion: "470.82.01"
+cudaVersion: "11.4"
+cards:
+- model: Tesla T4
+  memoryTotal: 15109
+  memoryReserved: 300
+  processes:
+  - pid: 100
+    loop: true
+    steps:
+    - {duration: 10s, mem: 2048, sm: 40}
+    - {duration: 10s, mem: 1024, sm: 0}
+  - pid: 101
+    start: 5s
+    steps:
+    - {duration: 10s, mem: 512, sm: 20}
+- model: A100-SXM4-40GB
+  memoryTotal: 40536
+  mig:
+  - {gpuInstance: 1, computeInstance: 0, profile: 3g.20gb, memoryTotal: 20096}
+  - {gpuInstance: 2, computeInstance: 0, profile: 3g.20gb, memoryTotal: 20096}
+  processes:
+  - pid: 200
+    mig: {gpuInstance: 2, computeInstance: 0}
+    steps:
+    - {mem: 8192, sm: 70}
+`
+
+// testClock is a clock the test moves by hand.
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	return c.now
+}
+
+func (c *testClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func writeScenario(t *testing.T, scenario string) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "scenario")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "scenario.yaml")
+	if err := ioutil.WriteFile(path, []byte(scenario), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func newTestDevice(t *testing.T) (*SimulatedDevice, *testClock) {
+	t.Helper()
+	device, err := NewDevice(BackendSimulated, writeScenario(t, testScenario))
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := &testClock{now: time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)}
+	simulated := device.(*SimulatedDevice)
+	simulated.SetClock(clock.Now)
+	return simulated, clock
+}
+
+func TestNewDevice(t *testing.T) {
+	if _, err := NewDevice("cuda", ""); err == nil {
+		t.Error("unknown backend accepted")
+	}
+	if _, err := NewDevice(BackendSimulated, ""); err == nil {
+		t.Error("simulated backend accepted without scenario")
+	}
+}
+
+func TestLoadScenarioRejectsUnknownMIGDevice(t *testing.T) {
+	scenario := `
+cards:
+- memoryTotal: 40536
+  mig:
+  - {gpuInstance: 1, computeInstance: 0, memoryTotal: 20096}
+  processes:
+  - pid: 1
+    mig: {gpuInstance: 3, computeInstance: 0}
+    steps:
+    - {mem: 1, sm: 1}
+`
+	if _, err := LoadScenario(writeScenario(t, scenario)); err == nil {
+		t.Error("process in an unknown MIG device accepted")
+	}
+}
+
+func TestSimulatedMemoryFollowsSteps(t *testing.T) {
+	device, clock := newTestDevice(t)
+	count, err := device.GetDeviceCount()
+	if err != nil || count != 2 {
+		t.Fatalf("GetDeviceCount() = %d, %v, want 2", count, err)
+	}
+	for _, tc := range []struct {
+		at   time.Duration
+		used uint64
+	}{
+		{at: 0, used: 300 + 2048},
+		{at: 6 * time.Second, used: 300 + 2048 + 512},
+		{at: 12 * time.Second, used: 300 + 1024 + 512},
+		// pid 101 exited, pid 100 loops back to its first step
+		{at: 22 * time.Second, used: 300 + 2048},
+	} {
+		clock.now = device.start.Add(tc.at)
+		used, total, err := device.GetDeviceMemory(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if used != tc.used || total != 15109 {
+			t.Errorf("at %v: GetDeviceMemory(0) = %d, %d, want %d, 15109", tc.at, used, total, tc.used)
+		}
+	}
+	if _, _, err := device.GetDeviceMemory(2); err == nil {
+		t.Error("GetDeviceMemory(2) of a missing card did not fail")
+	}
+}
+
+func TestSimulatedUsageAveragesWindow(t *testing.T) {
+	device, clock := newTestDevice(t)
+	// the first call looks back one second
+	clock.Advance(5 * time.Second)
+	if _, err := device.GetDeviceUsage(0); err != nil {
+		t.Fatal(err)
+	}
+	// one sample a second: pid 100 is at 40% until 10s then idle, pid 101 at 20%
+	// until it exits at 15s
+	clock.Advance(10 * time.Second)
+	usage, err := device.GetDeviceUsage(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := usage[100]; got == nil || got.GPUMem != 1024 || got.Context != process.ContextCompute {
+		t.Fatalf("usage of pid 100 = %+v, want 1024 MiB of compute", got)
+	}
+	if got := usage[100].GPUCore; got != 16 {
+		t.Errorf("core of pid 100 = %v, want 16", got)
+	}
+	if got := usage[101]; got == nil || got.GPUCore != 18 || got.GPUMem != 0 {
+		t.Errorf("usage of exited pid 101 = %+v, want 18%% core and no memory", got)
+	}
+}
+
+func TestSimulatedMIG(t *testing.T) {
+	device, _ := newTestDevice(t)
+	if migs, err := device.GetMIGDevices(0); err != nil || len(migs) != 0 {
+		t.Errorf("GetMIGDevices(0) = %v, %v, want none", migs, err)
+	}
+	migs, err := device.GetMIGDevices(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migs) != 2 {
+		t.Fatalf("GetMIGDevices(1) returned %d devices, want 2", len(migs))
+	}
+	if migs[0].MemoryUsed != 0 || migs[1].MemoryUsed != 8192 || migs[1].Profile != "3g.20gb" {
+		t.Errorf("GetMIGDevices(1) = %+v", migs)
+	}
+	usage, err := device.GetDeviceUsage(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := process.MIGSlice{GPUInstance: 2, ComputeInstance: 0}
+	if got := usage[200].MIG; got == nil || *got != want {
+		t.Errorf("MIG slice of pid 200 = %v, want %v", got, want)
+	}
+}
+
+func TestSimulatedAccounting(t *testing.T) {
+	device, clock := newTestDevice(t)
+	if _, err := device.GetAccountedProcesses(0); err == nil {
+		t.Error("GetAccountedProcesses succeeded with accounting off")
+	}
+	if err := device.EnableAccounting(0); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(10 * time.Second)
+	if finished, _ := device.GetAccountedProcesses(0); len(finished) != 0 {
+		t.Errorf("processes finished before they exited: %+v", finished)
+	}
+	clock.Advance(10 * time.Second)
+	finished, err := device.GetAccountedProcesses(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(finished) != 1 || finished[0].Pid != 101 || finished[0].MaxMem != 512 || finished[0].SM != 20 {
+		t.Errorf("GetAccountedProcesses(0) = %+v, want pid 101 with 512 MiB at 20%%", finished)
+	}
+}
+
+func TestSimulatedSystemInfo(t *testing.T) {
+	device, _ := newTestDevice(t)
+	info, err := device.GetSystemInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.DriverVersion != "470.82.01" || info.CUDAVersion != "11.4" {
+		t.Errorf("GetSystemInfo() = %+v", info)
+	}
+	card, err := device.GetDeviceInfo(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if card.Minor != 1 || card.UUID != "GPU-00000000-0000-0000-0000-000000000001" {
+		t.Errorf("GetDeviceInfo(1) = %+v", card)
+	}
+}
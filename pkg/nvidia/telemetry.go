@@ -0,0 +1,99 @@
+package nvidia
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Telemetry metric groups, each can be switched on or off.
+const (
+	GroupTemperature = "temperature"
+	GroupPower       = "power"
+	GroupClocks      = "clocks"
+	GroupFan         = "fan"
+	GroupPState      = "pstate"
+	GroupMemUtil     = "memutil"
+	GroupBAR1        = "bar1"
+	GroupCodec       = "codec"
+)
+
+var TelemetryGroups = []string{GroupTemperature, GroupPower, GroupClocks, GroupFan, GroupPState, GroupMemUtil, GroupBAR1, GroupCodec}
+
+// Groups is a set of telemetry metric groups.
+type Groups map[string]struct{}
+
+// ParseGroups reads a comma separated list of groups.
+func ParseGroups(list string) (Groups, error) {
+	known := make(map[string]struct{})
+	for _, group := range TelemetryGroups {
+		known[group] = struct{}{}
+	}
+	groups := make(Groups)
+	for _, group := range strings.Split(list, ",") {
+		group = strings.TrimSpace(group)
+		if group == "" {
+			continue
+		}
+		if _, ok := known[group]; !ok {
+			return nil, fmt.Errorf("unknown metric group %q", group)
+		}
+		groups[group] = struct{}{}
+	}
+	return groups, nil
+}
+
+func (g Groups) Has(group string) bool {
+	_, ok := g[group]
+	return ok
+}
+
+// Telemetry holds the card readings of the enabled groups. A field is nil when its
+// group is off or the card does not support the reading. The simulated backend reads
+// it from the scenario as is.
+type Telemetry struct {
+	// Temperature is in degrees Celsius.
+	Temperature *float64 `json:"temperature,omitempty"`
+	// PowerUsage and PowerLimit are in watts.
+	PowerUsage *float64 `json:"powerUsage,omitempty"`
+	PowerLimit *float64 `json:"powerLimit,omitempty"`
+	// SMClock and MemClock are in MHz.
+	SMClock  *float64 `json:"smClock,omitempty"`
+	MemClock *float64 `json:"memClock,omitempty"`
+	// FanSpeed is in percent of the maximum speed.
+	FanSpeed *float64 `json:"fanSpeed,omitempty"`
+	// PState is the performance state, 0 (maximum) to 15 (minimum).
+	PState *float64 `json:"pState,omitempty"`
+	// BAR1Used and BAR1Total are in MiB.
+	BAR1Used  *float64 `json:"bar1Used,omitempty"`
+	BAR1Total *float64 `json:"bar1Total,omitempty"`
+	// EncoderUtil and DecoderUtil are the video encoder and decoder utilization in
+	// percent.
+	EncoderUtil *float64 `json:"encoderUtil,omitempty"`
+	DecoderUtil *float64 `json:"decoderUtil,omitempty"`
+}
+
+// filter drops the readings of the groups which are off.
+func (t Telemetry) filter(groups Groups) *Telemetry {
+	if !groups.Has(GroupTemperature) {
+		t.Temperature = nil
+	}
+	if !groups.Has(GroupPower) {
+		t.PowerUsage, t.PowerLimit = nil, nil
+	}
+	if !groups.Has(GroupClocks) {
+		t.SMClock, t.MemClock = nil, nil
+	}
+	if !groups.Has(GroupFan) {
+		t.FanSpeed = nil
+	}
+	if !groups.Has(GroupPState) {
+		t.PState = nil
+	}
+	if !groups.Has(GroupBAR1) {
+		t.BAR1Used, t.BAR1Total = nil, nil
+	}
+	if !groups.Has(GroupCodec) {
+		t.EncoderUtil, t.DecoderUtil = nil, nil
+	}
+	return &t
+}
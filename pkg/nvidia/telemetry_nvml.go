@@ -0,0 +1,90 @@
+//go:build cgo
+// +build cgo
+
+package nvidia
+
+import (
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	"k8s.io/klog"
+)
+
+func (device *DeviceImpl) GetDeviceTelemetry(cardNum int, groups Groups) (*Telemetry, error) {
+	dev, _, release, err := device.session.Handle(cardNum)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	t := &Telemetry{}
+	// read keeps the value of a reading the card supports; only errors which lost
+	// the session fail the whole call.
+	read := func(name string, value uint64, ret nvml.Return, scale float64) (*float64, error) {
+		if err := check(ret); err != nil {
+			if isFatal(err) {
+				return nil, device.session.Check(err)
+			}
+			klog.V(4).Infof("Can't get %s of device %d: %v", name, cardNum, err)
+			return nil, nil
+		}
+		v := float64(value) * scale
+		return &v, nil
+	}
+	if groups.Has(GroupTemperature) {
+		value, ret := dev.GetTemperature(nvml.TEMPERATURE_GPU)
+		if t.Temperature, err = read("temperature", uint64(value), ret, 1); err != nil {
+			return nil, err
+		}
+	}
+	if groups.Has(GroupPower) {
+		value, ret := dev.GetPowerUsage()
+		if t.PowerUsage, err = read("power usage", uint64(value), ret, 0.001); err != nil {
+			return nil, err
+		}
+		value, ret = dev.GetEnforcedPowerLimit()
+		if t.PowerLimit, err = read("power limit", uint64(value), ret, 0.001); err != nil {
+			return nil, err
+		}
+	}
+	if groups.Has(GroupClocks) {
+		value, ret := dev.GetClockInfo(nvml.CLOCK_SM)
+		if t.SMClock, err = read("sm clock", uint64(value), ret, 1); err != nil {
+			return nil, err
+		}
+		value, ret = dev.GetClockInfo(nvml.CLOCK_MEM)
+		if t.MemClock, err = read("memory clock", uint64(value), ret, 1); err != nil {
+			return nil, err
+		}
+	}
+	if groups.Has(GroupFan) {
+		value, ret := dev.GetFanSpeed()
+		if t.FanSpeed, err = read("fan speed", uint64(value), ret, 1); err != nil {
+			return nil, err
+		}
+	}
+	if groups.Has(GroupPState) {
+		value, ret := dev.GetPerformanceState()
+		if t.PState, err = read("performance state", uint64(value), ret, 1); err != nil {
+			return nil, err
+		}
+	}
+	if groups.Has(GroupBAR1) {
+		bar1, ret := dev.GetBAR1MemoryInfo()
+		if t.BAR1Used, err = read("bar1 memory", bar1.Bar1Used>>20, ret, 1); err != nil {
+			return nil, err
+		}
+		if t.BAR1Used != nil {
+			bar1Total := float64(bar1.Bar1Total >> 20)
+			t.BAR1Total = &bar1Total
+		}
+	}
+	if groups.Has(GroupCodec) {
+		value, _, ret := dev.GetEncoderUtilization()
+		if t.EncoderUtil, err = read("encoder utilization", uint64(value), ret, 1); err != nil {
+			return nil, err
+		}
+		value, _, ret = dev.GetDecoderUtilization()
+		if t.DecoderUtil, err = read("decoder utilization", uint64(value), ret, 1); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
@@ -0,0 +1,29 @@
+package nvidia
+
+// Clock throttle reasons.
+const (
+	ThrottleGpuIdle           = "gpu_idle"
+	ThrottleApplicationClocks = "applications_clocks_setting"
+	ThrottleSwPowerCap        = "sw_power_cap"
+	ThrottleHwSlowdown        = "hw_slowdown"
+	ThrottleSyncBoost         = "sync_boost"
+	ThrottleThermalSlowdown   = "thermal_slowdown"
+)
+
+var ThrottleReasons = []string{
+	ThrottleGpuIdle,
+	ThrottleApplicationClocks,
+	ThrottleSwPowerCap,
+	ThrottleHwSlowdown,
+	ThrottleSyncBoost,
+	ThrottleThermalSlowdown,
+}
+
+// SlowdownReasons are the throttle reasons which slow down the work on a card, as
+// opposed to the card being idle or clocked down on purpose.
+var SlowdownReasons = map[string]struct{}{
+	ThrottleSwPowerCap:      {},
+	ThrottleHwSlowdown:      {},
+	ThrottleSyncBoost:       {},
+	ThrottleThermalSlowdown: {},
+}
@@ -0,0 +1,85 @@
+//go:build cgo
+// +build cgo
+
+package nvidia
+
+import (
+	"sync"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	"k8s.io/klog"
+)
+
+// throttleBits are the NVML clock throttle reason bits of every reason.
+var throttleBits = map[string]uint64{
+	ThrottleGpuIdle:           nvml.ClocksThrottleReasonGpuIdle,
+	ThrottleApplicationClocks: nvml.ClocksThrottleReasonApplicationsClocksSetting,
+	ThrottleSwPowerCap:        nvml.ClocksThrottleReasonSwPowerCap,
+	ThrottleHwSlowdown:        nvml.ClocksThrottleReasonHwSlowdown,
+	ThrottleSyncBoost:         nvml.ClocksThrottleReasonSyncBoost,
+	ThrottleThermalSlowdown:   nvml.ClocksThrottleReasonSwThermalSlowdown | nvml.ClocksThrottleReasonHwThermalSlowdown,
+}
+
+// violations keeps per card the power and thermal violation time seen last.
+type violations struct {
+	mu    sync.Mutex
+	power map[string]uint64
+	therm map[string]uint64
+}
+
+func newViolations() *violations {
+	return &violations{
+		mu:    sync.Mutex{},
+		power: make(map[string]uint64),
+		therm: make(map[string]uint64),
+	}
+}
+
+// grew records the violation time of a card and tells whether it grew since the
+// last call. The first call of a card never grows.
+func (v *violations) grew(seen map[string]uint64, card string, value uint64) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	last, ok := seen[card]
+	seen[card] = value
+	return ok && value > last
+}
+
+// GetDeviceThrottle returns the throttle reasons the card can tell, true for the
+// active ones. The current reasons only hold at the moment of the call, so power
+// capping and thermal slowdown are also taken from the violation counters, which
+// cover the whole time since the previous call.
+func (device *DeviceImpl) GetDeviceThrottle(cardNum int) (map[string]bool, error) {
+	dev, uuid, release, err := device.session.Handle(cardNum)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	current, ret := dev.GetCurrentClocksThrottleReasons()
+	if err := check(ret); err != nil {
+		if isFatal(err) {
+			return nil, device.session.Check(err)
+		}
+		klog.V(4).Infof("Can't get throttle reasons of device %d: %v", cardNum, err)
+		return map[string]bool{}, nil
+	}
+	reasons := make(map[string]bool, len(throttleBits))
+	for reason, bits := range throttleBits {
+		reasons[reason] = current&bits != 0
+	}
+	if power, ret := dev.GetViolationStatus(nvml.PERF_POLICY_POWER); ret == nvml.SUCCESS {
+		if device.violations.grew(device.violations.power, uuid, power.ViolationTime) {
+			reasons[ThrottleSwPowerCap] = true
+		}
+	} else if err := check(ret); isFatal(err) {
+		return nil, device.session.Check(err)
+	}
+	if thermal, ret := dev.GetViolationStatus(nvml.PERF_POLICY_THERMAL); ret == nvml.SUCCESS {
+		if device.violations.grew(device.violations.therm, uuid, thermal.ViolationTime) {
+			reasons[ThrottleThermalSlowdown] = true
+		}
+	} else if err := check(ret); isFatal(err) {
+		return nil, device.session.Check(err)
+	}
+	return reasons, nil
+}
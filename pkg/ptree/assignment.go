@@ -0,0 +1,156 @@
+package ptree
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	NvidiaVisibleDevices = "NVIDIA_VISIBLE_DEVICES"
+	CUDAVisibleDevices   = "CUDA_VISIBLE_DEVICES"
+
+	procEnviron       = "environ"
+	devicesController = "devices"
+	devicesList       = "devices.list"
+	// nvidiaMajor is the major number of the /dev/nvidia<minor> device nodes, minor
+	// 255 is /dev/nvidiactl and 254 /dev/nvidia-modeset, neither is a card.
+	nvidiaMajor        = "195"
+	nvidiaCtlMinor     = 255
+	nvidiaModesetMinor = 254
+)
+
+// Assignment are the cards a container was given, whether or not it uses them.
+type Assignment struct {
+	// All is set when the environment gives the container every card.
+	All bool
+	// Devices are the cards listed in the environment, as indexes or GPU-/MIG- UUIDs.
+	Devices []string
+	// Restricted is set when the device cgroup only allows some cards, Minors are
+	// then the minor numbers of those cards and take precedence over the environment.
+	Restricted bool
+	Minors     []int
+}
+
+// ResolveAssignment works out the cards of the container pid runs in, from
+// NVIDIA_VISIBLE_DEVICES (or CUDA_VISIBLE_DEVICES when unset) in its environment
+// and, on cgroup v1, from the devices.list of its device cgroup.
+func ResolveAssignment(fs FS, procRoot, sysRoot string, pid int) (*Assignment, error) {
+	env, err := readEnviron(fs, filepath.Join(procRoot, strconv.Itoa(pid), procEnviron))
+	if err != nil {
+		return nil, err
+	}
+	assignment := &Assignment{}
+	value, ok := env[NvidiaVisibleDevices]
+	if !ok {
+		value = env[CUDAVisibleDevices]
+	}
+	switch value = strings.TrimSpace(value); value {
+	case "", "none", "void", "NoDevFiles":
+	case "all":
+		assignment.All = true
+	default:
+		for _, device := range strings.Split(value, ",") {
+			if device = strings.TrimSpace(device); device != "" {
+				assignment.Devices = append(assignment.Devices, device)
+			}
+		}
+	}
+	cgroup, err := deviceCgroup(fs, procRoot, pid)
+	if err != nil || cgroup == "" {
+		// cgroup v2 has no devices.list, the environment is all there is
+		return assignment, nil
+	}
+	minors, restricted, err := readDevicesList(fs, filepath.Join(CgroupRoot(sysRoot), devicesController, cgroup, devicesList))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+		return assignment, nil
+	}
+	assignment.Restricted, assignment.Minors = restricted, minors
+	return assignment, nil
+}
+
+// readEnviron reads the NUL separated environment of a process.
+func readEnviron(fs FS, path string) (map[string]string, error) {
+	file, err := fs.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	env := make(map[string]string)
+	for _, entry := range bytes.Split(data, []byte{0}) {
+		if kv := strings.SplitN(string(entry), "=", 2); len(kv) == 2 {
+			env[kv[0]] = kv[1]
+		}
+	}
+	return env, nil
+}
+
+// deviceCgroup returns the path of the device cgroup of pid in the cgroup v1
+// devices hierarchy, empty when there is none.
+func deviceCgroup(fs FS, procRoot string, pid int) (string, error) {
+	file, err := fs.Open(filepath.Join(procRoot, strconv.Itoa(pid), procCgroup))
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// hierarchy-ID:controller-list:cgroup-path
+		fields := strings.SplitN(scanner.Text(), ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		for _, controller := range strings.Split(fields[1], ",") {
+			if controller == devicesController {
+				return fields[2], nil
+			}
+		}
+	}
+	return "", scanner.Err()
+}
+
+// readDevicesList returns the minor numbers of the cards a devices.list allows. It
+// is not restricted when any card may be opened, e.g. "a *:* rwm" of privileged
+// containers.
+func readDevicesList(fs FS, path string) ([]int, bool, error) {
+	file, err := fs.Open(path)
+	if err != nil {
+		return nil, false, err
+	}
+	defer file.Close()
+	var minors []int
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// type major:minor access
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 || !strings.ContainsAny(fields[2], "rw") {
+			// e.g. "c *:* m" only allows creating device nodes
+			continue
+		}
+		if fields[0] == "a" {
+			return nil, false, nil
+		}
+		numbers := strings.SplitN(fields[1], ":", 2)
+		if fields[0] != "c" || len(numbers) != 2 || (numbers[0] != nvidiaMajor && numbers[0] != "*") {
+			continue
+		}
+		if numbers[1] == "*" {
+			return nil, false, nil
+		}
+		if minor, err := strconv.Atoi(numbers[1]); err == nil && minor != nvidiaCtlMinor && minor != nvidiaModesetMinor {
+			minors = append(minors, minor)
+		}
+	}
+	return minors, true, scanner.Err()
+}
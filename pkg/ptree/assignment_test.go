@@ -0,0 +1,144 @@
+package ptree
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testSys = "/host/sys"
+
+// environ joins the entries of an environment as /proc/<pid>/environ does.
+func environ(entries ...string) string {
+	return strings.Join(entries, "\x00") + "\x00"
+}
+
+func TestReadEnviron(t *testing.T) {
+	path := filepath.Join(testProc, "100", procEnviron)
+	fs := newMapFS(map[string]string{
+		path: environ("PATH=/usr/bin", "NVIDIA_VISIBLE_DEVICES=GPU-8f3a", "OPTS=a=b", "BROKEN"),
+	})
+	env, err := readEnviron(fs, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"PATH": "/usr/bin", NvidiaVisibleDevices: "GPU-8f3a", "OPTS": "a=b"}
+	if !reflect.DeepEqual(env, want) {
+		t.Errorf("readEnviron() = %v, want %v", env, want)
+	}
+	if _, err := readEnviron(fs, filepath.Join(testProc, "101", procEnviron)); err == nil {
+		t.Error("readEnviron() of an exited process succeeded")
+	}
+}
+
+func TestReadDevicesList(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		list       string
+		minors     []int
+		restricted bool
+	}{
+		{name: "privileged", list: "a *:* rwm\n"},
+		{name: "every card", list: "c 1:3 rwm\nc 195:* rwm\n"},
+		{
+			name:       "cards",
+			list:       "c 1:3 rwm\nc 195:255 rw\nc 195:254 rw\nc 195:1 rw\nc 195:3 rwm\nc 195:2 m\n",
+			minors:     []int{1, 3},
+			restricted: true,
+		},
+		{
+			// containerd allows creating any character device node
+			name:       "mknod only",
+			list:       "c *:* m\nb *:* m\nc 195:0 rw\n",
+			minors:     []int{0},
+			restricted: true,
+		},
+		{name: "no card", list: "c 1:3 rwm\nc 195:255 rw\n", restricted: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(CgroupRoot(testSys), devicesController, "pod", devicesList)
+			minors, restricted, err := readDevicesList(newMapFS(map[string]string{path: tc.list}), path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(minors, tc.minors) || restricted != tc.restricted {
+				t.Errorf("readDevicesList() = %v, %v, want %v, %v", minors, restricted, tc.minors, tc.restricted)
+			}
+		})
+	}
+}
+
+func TestResolveAssignment(t *testing.T) {
+	devices := "/kubepods/burstable/pod" + testUID + "/" + containerA
+	v1 := "12:devices:" + devices + "\n11:memory:" + devices + "\n"
+	v2 := "0::/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod" +
+		strings.Replace(testUID, "-", "_", -1) + ".slice/cri-containerd-" + containerA + ".scope\n"
+	for _, tc := range []struct {
+		name    string
+		env     []string
+		cgroup  string
+		devices string
+		want    Assignment
+	}{
+		{name: "all", env: []string{"NVIDIA_VISIBLE_DEVICES=all"}, cgroup: v2, want: Assignment{All: true}},
+		{name: "none", env: []string{"NVIDIA_VISIBLE_DEVICES=none"}, cgroup: v2},
+		{name: "void", env: []string{"NVIDIA_VISIBLE_DEVICES=void"}, cgroup: v2},
+		{name: "no device files", env: []string{"NVIDIA_VISIBLE_DEVICES=NoDevFiles"}, cgroup: v2},
+		{name: "unset", env: []string{"PATH=/usr/bin"}, cgroup: v2},
+		{
+			name:   "uuids",
+			env:    []string{"NVIDIA_VISIBLE_DEVICES=GPU-8f3a, MIG-GPU-17c2/1/0"},
+			cgroup: v2,
+			want:   Assignment{Devices: []string{"GPU-8f3a", "MIG-GPU-17c2/1/0"}},
+		},
+		{name: "indexes", env: []string{"NVIDIA_VISIBLE_DEVICES=0,2,"}, cgroup: v2, want: Assignment{Devices: []string{"0", "2"}}},
+		{name: "cuda fallback", env: []string{"CUDA_VISIBLE_DEVICES=1"}, cgroup: v2, want: Assignment{Devices: []string{"1"}}},
+		{
+			// an empty NVIDIA_VISIBLE_DEVICES is set, CUDA_VISIBLE_DEVICES is ignored
+			name:   "cuda ignored",
+			env:    []string{"NVIDIA_VISIBLE_DEVICES=", "CUDA_VISIBLE_DEVICES=1"},
+			cgroup: v2,
+		},
+		{
+			name:    "device cgroup",
+			env:     []string{"NVIDIA_VISIBLE_DEVICES=all"},
+			cgroup:  v1,
+			devices: "c 195:255 rw\nc 195:254 rw\nc 195:1 rw\n",
+			want:    Assignment{All: true, Restricted: true, Minors: []int{1}},
+		},
+		{
+			name:    "privileged",
+			env:     []string{"NVIDIA_VISIBLE_DEVICES=0"},
+			cgroup:  v1,
+			devices: "a *:* rwm\n",
+			want:    Assignment{Devices: []string{"0"}},
+		},
+		{
+			name:   "device cgroup gone",
+			env:    []string{"NVIDIA_VISIBLE_DEVICES=0"},
+			cgroup: v1,
+			want:   Assignment{Devices: []string{"0"}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			files := map[string]string{
+				filepath.Join(testProc, "100", procEnviron): environ(tc.env...),
+				filepath.Join(testProc, "100", procCgroup):  tc.cgroup,
+			}
+			if tc.devices != "" {
+				files[filepath.Join(CgroupRoot(testSys), devicesController, devices, devicesList)] = tc.devices
+			}
+			got, err := ResolveAssignment(newMapFS(files), testProc, testSys, 100)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(*got, tc.want) {
+				t.Errorf("ResolveAssignment() = %+v, want %+v", *got, tc.want)
+			}
+		})
+	}
+	if _, err := ResolveAssignment(newMapFS(map[string]string{}), testProc, testSys, 100); err == nil {
+		t.Error("ResolveAssignment() of an exited process succeeded")
+	}
+}
@@ -0,0 +1,66 @@
+package ptree
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+const (
+	// SysRoot and ProcRoot are where the host sysfs and procfs are mounted in the
+	// exporter container.
+	SysRoot  = "/host/sys"
+	ProcRoot = "/host/proc"
+)
+
+// CgroupRoot returns where the cgroup filesystem is mounted under sysRoot.
+func CgroupRoot(sysRoot string) string {
+	return filepath.Join(sysRoot, "fs", "cgroup")
+}
+
+// FS is the filesystem the scanners read cgroups and procfs from, so that they can
+// run on any root or against an in-memory tree.
+type FS interface {
+	ReadDir(name string) ([]os.FileInfo, error)
+	Open(name string) (io.ReadCloser, error)
+	Stat(name string) (os.FileInfo, error)
+}
+
+// fsTyper is a FS which can tell the filesystem type of a path.
+type fsTyper interface {
+	FSType(name string) (int64, error)
+}
+
+// OSFS is the filesystem of the operating system.
+type OSFS struct{}
+
+func NewOSFS() FS {
+	return OSFS{}
+}
+
+func (OSFS) ReadDir(name string) ([]os.FileInfo, error) {
+	return ioutil.ReadDir(name)
+}
+
+func (OSFS) Open(name string) (io.ReadCloser, error) {
+	return os.Open(name)
+}
+
+func (OSFS) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (OSFS) FSType(name string) (int64, error) {
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(name, &fs); err != nil {
+		return 0, err
+	}
+	return int64(fs.Type), nil
+}
+
+func exists(fs FS, path string) bool {
+	_, err := fs.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,111 @@
+package ptree
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing/iotest"
+	"time"
+)
+
+// mapFS is an in-memory FS holding files by their path; the directories are the
+// parents of the files.
+type mapFS struct {
+	files map[string]string
+	// broken are files whose reads fail with the error.
+	broken map[string]error
+	// magic is the filesystem type FSType reports, none when 0.
+	magic int64
+	// afterReadDir is called once a directory was listed, to change the tree while
+	// it is scanned.
+	afterReadDir func(name string)
+}
+
+func newMapFS(files map[string]string) *mapFS {
+	return &mapFS{files: files}
+}
+
+func (fs *mapFS) ReadDir(name string) ([]os.FileInfo, error) {
+	name = filepath.Clean(name)
+	children := make(map[string]bool)
+	for path := range fs.files {
+		rest := strings.TrimPrefix(path, name+"/")
+		if rest == path {
+			continue
+		}
+		child := strings.SplitN(rest, "/", 2)
+		children[child[0]] = children[child[0]] || len(child) == 2
+	}
+	if len(children) == 0 {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	var infos []os.FileInfo
+	for child, dir := range children {
+		infos = append(infos, fileInfo{name: child, dir: dir})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+	if fs.afterReadDir != nil {
+		fs.afterReadDir(name)
+	}
+	return infos, nil
+}
+
+func (fs *mapFS) Open(name string) (io.ReadCloser, error) {
+	content, ok := fs.files[filepath.Clean(name)]
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	if err, ok := fs.broken[filepath.Clean(name)]; ok {
+		return ioutil.NopCloser(iotest.ErrReader(err)), nil
+	}
+	return ioutil.NopCloser(strings.NewReader(content)), nil
+}
+
+func (fs *mapFS) Stat(name string) (os.FileInfo, error) {
+	name = filepath.Clean(name)
+	if _, ok := fs.files[name]; ok {
+		return fileInfo{name: filepath.Base(name)}, nil
+	}
+	for path := range fs.files {
+		if strings.HasPrefix(path, name+"/") {
+			return fileInfo{name: filepath.Base(name), dir: true}, nil
+		}
+	}
+	return nil, &os.PathError{Op: "stat", Path: name, Err: os.ErrNotExist}
+}
+
+func (fs *mapFS) FSType(name string) (int64, error) {
+	if fs.magic == 0 {
+		return 0, &os.PathError{Op: "statfs", Path: name, Err: os.ErrInvalid}
+	}
+	return fs.magic, nil
+}
+
+// remove deletes the files under dir.
+func (fs *mapFS) remove(dir string) {
+	for path := range fs.files {
+		if strings.HasPrefix(path, dir+"/") {
+			delete(fs.files, path)
+		}
+	}
+}
+
+type fileInfo struct {
+	name string
+	dir  bool
+}
+
+func (fi fileInfo) Name() string { return fi.name }
+func (fi fileInfo) Size() int64  { return 0 }
+func (fi fileInfo) Mode() os.FileMode {
+	if fi.dir {
+		return os.ModeDir | 0555
+	}
+	return 0444
+}
+func (fi fileInfo) ModTime() time.Time { return time.Time{} }
+func (fi fileInfo) IsDir() bool        { return fi.dir }
+func (fi fileInfo) Sys() interface{}   { return nil }
@@ -32,14 +32,14 @@ type PTreeImpl struct {
 	scanner         Scanner
 }
 
-func NewPTree(interval time.Duration) *PTreeImpl {
+func NewPTree(interval time.Duration, scanner Scanner) *PTreeImpl {
 	return &PTreeImpl{
 		interval:        interval,
 		mu:              sync.Mutex{},
 		interestingPods: make(map[string]string),
 		nodeSnapshot:    NewNode(),
 		lastUpdate:      time.Now(),
-		scanner:         NewScanner(),
+		scanner:         scanner,
 	}
 }
 
@@ -88,6 +88,11 @@ func (p *PTreeImpl) nextSnapshot() error {
 		errors   = []string{}
 		snapshot = NewNode()
 	)
+	if r, ok := p.scanner.(refresher); ok {
+		if err := r.refresh(); err != nil {
+			return err
+		}
+	}
 	for UID, QOS := range pods {
 		pod, err, exist := p.scanner.Scan(UID, QOS)
 		if err != nil{
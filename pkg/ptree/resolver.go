@@ -0,0 +1,98 @@
+package ptree
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Cgroup drivers of the kubelet.
+const (
+	CgroupDriverAuto     = "auto"
+	CgroupDriverCgroupfs = "cgroupfs"
+	CgroupDriverSystemd  = "systemd"
+)
+
+var CgroupDrivers = []string{CgroupDriverAuto, CgroupDriverCgroupfs, CgroupDriverSystemd}
+
+const (
+	systemdSlice = ".slice"
+	systemdScope = ".scope"
+	// crioConmon prefixes the scope of the monitor process CRI-O starts beside
+	// every container.
+	crioConmon = "crio-conmon-"
+)
+
+// PathResolver knows where a cgroup driver puts pods and containers.
+type PathResolver interface {
+	// PodPath returns the cgroup of a pod relative to the hierarchy root.
+	PodPath(UID, QOS string) string
+	// ContainerID returns the container ID of a child cgroup of a pod, false if
+	// the cgroup is not a container.
+	ContainerID(name string) (string, bool)
+}
+
+// NewPathResolver returns the resolver of driver; auto picks the driver whose
+// kubepods cgroup exists under root.
+func NewPathResolver(fs FS, driver, root string) (PathResolver, error) {
+	switch driver {
+	case CgroupDriverCgroupfs:
+		return cgroupfsResolver{}, nil
+	case CgroupDriverSystemd:
+		return systemdResolver{}, nil
+	case CgroupDriverAuto, "":
+		if exists(fs, filepath.Join(root, kubeRoot+systemdSlice)) {
+			return systemdResolver{}, nil
+		}
+		return cgroupfsResolver{}, nil
+	}
+	return nil, fmt.Errorf("unknown cgroup driver %q", driver)
+}
+
+// cgroupfsResolver resolves paths such as kubepods/burstable/pod<uid>/<id>.
+type cgroupfsResolver struct{}
+
+func (cgroupfsResolver) PodPath(UID, QOS string) string {
+	return getPodPath(UID, QOS)
+}
+
+func (cgroupfsResolver) ContainerID(name string) (string, bool) {
+	return scopeContainerID(name)
+}
+
+// systemdResolver resolves paths such as
+// kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod<uid>.slice/cri-containerd-<id>.scope,
+// where the dashes of the pod UID become underscores.
+type systemdResolver struct{}
+
+func (systemdResolver) PodPath(UID, QOS string) string {
+	parentPath := CgroupName{kubeRoot + systemdSlice}
+	parent := kubeRoot
+	if QOS == QOSBurstable || QOS == QOSBestEffort {
+		parent = kubeRoot + "-" + QOS
+		parentPath = append(parentPath, parent+systemdSlice)
+	}
+	pod := parent + "-" + PodPrefix + strings.Replace(UID, "-", "_", -1) + systemdSlice
+	return transformToPath(append(parentPath, pod))
+}
+
+func (systemdResolver) ContainerID(name string) (string, bool) {
+	return scopeContainerID(name)
+}
+
+// scopeContainerID reads the container ID from a cgroup named after it, either
+// plainly or after the prefix of its runtime, such as docker-<id>.scope,
+// cri-containerd-<id>.scope or crio-<id>, with or without the scope suffix.
+func scopeContainerID(name string) (string, bool) {
+	if IsContainerID(name) {
+		return name, true
+	}
+	if strings.HasPrefix(name, crioConmon) {
+		return "", false
+	}
+	id := strings.TrimSuffix(name, systemdScope)
+	if i := strings.LastIndex(id, "-"); i >= 0 {
+		id = id[i+1:]
+	}
+	return id, IsContainerID(id)
+}
@@ -0,0 +1,32 @@
+package ptree
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestScopeContainerID(t *testing.T) {
+	id := strings.Repeat("0123abcd", 8)
+	for _, tc := range []struct {
+		name string
+		want string
+	}{
+		{name: id, want: id},
+		{name: "docker-" + id + ".scope", want: id},
+		{name: "cri-containerd-" + id + ".scope", want: id},
+		{name: "crio-" + id + ".scope", want: id},
+		// CRI-O with the cgroupfs driver
+		{name: "crio-" + id, want: id},
+		{name: "docker-" + id, want: id},
+		{name: "crio-conmon-" + id + ".scope"},
+		{name: "crio-conmon-" + id},
+		{name: "init.scope"},
+		{name: "cgroup.procs"},
+		{name: "crio-" + id[:12]},
+	} {
+		got, ok := scopeContainerID(tc.name)
+		if ok != (tc.want != "") || ok && got != tc.want {
+			t.Errorf("scopeContainerID(%q) = %q, %v, want %q", tc.name, got, ok, tc.want)
+		}
+	}
+}
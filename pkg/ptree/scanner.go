@@ -1,21 +1,19 @@
 package ptree
 
 import (
-	"bufio"
-	"io/ioutil"
 	"k8s.io/klog"
 	"os"
 	"path"
 	"path/filepath"
 	"regexp"
-	"strconv"
 	"sync"
 )
 const(
 	QOSGuaranteed = "guaranteed"
 	QOSBurstable  = "burstable"
 	QOSBestEffort = "besteffort"
-	CgroupBase    = "/host/sys/fs/cgroup/memory"
+	// memoryController is the cgroup v1 hierarchy the pods are scanned in.
+	memoryController = "memory"
 	PodPrefix     = "pod"
 	CgroupProcs   = "cgroup.procs"
 	kubeRoot      = "kubepods"
@@ -35,16 +33,47 @@ type Scanner interface {
 	deleteContainer(UID string)
 }
 
+// refresher is a Scanner which reads the whole node once before a snapshot scans
+// the pods.
+type refresher interface {
+	refresh() error
+}
+
 type ScannerImpl struct{
 	nodeCache *Node
 	mu        sync.Mutex
+	fs        FS
+	base      string
+	resolver  PathResolver
+	opts      ScanOptions
 }
 
-func NewScanner() Scanner {
+// NewScanner returns the scanner of the cgroup hierarchy mounted under sysRoot,
+// laid out by the cgroup driver.
+func NewScanner(fs FS, sysRoot, driver string, opts ScanOptions) (Scanner, error) {
+	root := CgroupRoot(sysRoot)
+	if IsCgroupV2(fs, root) {
+		resolver, err := NewPathResolver(fs, driver, root)
+		if err != nil {
+			return nil, err
+		}
+		klog.Infof("Found cgroup v2 at %s, %T", root, resolver)
+		return NewCgroupV2Scanner(fs, root, resolver, opts), nil
+	}
+	base := filepath.Join(root, memoryController)
+	resolver, err := NewPathResolver(fs, driver, base)
+	if err != nil {
+		return nil, err
+	}
+	klog.Infof("Found cgroup v1 at %s, %T", base, resolver)
 	return &ScannerImpl{
 		nodeCache:    NewNode(),
 		mu:           sync.Mutex{},
-	}
+		fs:           fs,
+		base:         base,
+		resolver:     resolver,
+		opts:         opts,
+	}, nil
 }
 
 func (scan *ScannerImpl) deletePod(UID string){
@@ -78,8 +107,8 @@ func (scan *ScannerImpl) Scan(UID, QOS string) (Pod, error, bool) {
 }
 
 func (scan *ScannerImpl) getContainers(p *Pod) (*Pod, error, bool) {
-	podPath := scan.getPodPath(p.UID, p.QOS)
-	basePodPath := filepath.Clean(filepath.Join(CgroupBase, podPath))
+	podPath := scan.resolver.PodPath(p.UID, p.QOS)
+	basePodPath := filepath.Clean(filepath.Join(scan.base, podPath))
 	containers, err, exist := scan.readContainerFile(basePodPath, p, p.UID)
 	if !exist {
 		return nil, nil, exist
@@ -96,7 +125,7 @@ func (scan *ScannerImpl) getContainers(p *Pod) (*Pod, error, bool) {
 }
 
 //getPodPath is to get the path of the pod ,such as:kubepods/besteffort/pod17eb80b0-6085-4d12-8e79-553e799d2f0b
-func (scan *ScannerImpl) getPodPath(UID string, QOS string) (podPath string) {
+func getPodPath(UID string, QOS string) (podPath string) {
 	var parentPath CgroupName
 	switch QOS {
 	case QOSGuaranteed:
@@ -108,26 +137,26 @@ func (scan *ScannerImpl) getPodPath(UID string, QOS string) (podPath string) {
 	}
 	podContainer := PodPrefix + UID
 	parentPath = append(parentPath,podContainer)
-	podPath = scan.transformToPath(parentPath)
+	podPath = transformToPath(parentPath)
 	return podPath
 }
 
-func (scan *ScannerImpl) transformToPath(cgroupName CgroupName) string {
+func transformToPath(cgroupName CgroupName) string {
 	return "/" + path.Join(cgroupName...)
 }
 
 func (scan *ScannerImpl)readContainerFile(podPath string, pod *Pod, UID string) (map[string]*Container, error, bool) {
-	if !IsExist(podPath) {
+	if !exists(scan.fs, podPath) {
 		return nil, nil, false
 	}
-	fileList, err := ioutil.ReadDir(podPath)
+	fileList, err := scan.fs.ReadDir(podPath)
 	if err != nil {
 		klog.Errorf("Can't read %s, %v", podPath, err)
 		return nil, err, true
 	}
 	for _,file :=range fileList {
-		containerId := file.Name()
-		if IsContainerID(containerId) {
+		containerId, ok := scan.resolver.ContainerID(file.Name())
+		if ok {
 			if scan.nodeCache.Pods[UID] == nil {
 				scan.nodeCache.Pods[UID] = NewPod(pod.QOS, pod.UID)
 			}
@@ -136,7 +165,7 @@ func (scan *ScannerImpl)readContainerFile(podPath string, pod *Pod, UID string)
 				ID: containerId,
 				Parent: pod.UID,
 			}
-			procPath := filepath.Join(podPath, containerId, CgroupProcs)
+			procPath := filepath.Join(podPath, file.Name(), CgroupProcs)
 			process, err := scan.readPidFile(procPath, scan.nodeCache.Pods[UID].Containers[containerId], containerId)
 			if err != nil {
 				klog.Errorf("Cannot read the pid in the container: %s, %v", containerId, err)
@@ -149,28 +178,24 @@ func (scan *ScannerImpl)readContainerFile(podPath string, pod *Pod, UID string)
 }
 
 func (scan *ScannerImpl)readPidFile(procPath string, container *Container, containerId string) (map[int]*Process, error) {
-	file, err := os.Open(procPath)
+	pids, err := containerPids(scan.fs, filepath.Dir(procPath), CgroupTasks, scan.opts)
 	if err != nil {
 		klog.Errorf("Cannot read %s, %v", procPath, err)
 		return nil, err
 	}
-	defer file.Close()
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := scanner.Text()
-		if scan.nodeCache.Containers[containerId] == nil {
-			scan.nodeCache.Containers[containerId] = NewContainer(containerId)
-
-		}
-		if pid, err := strconv.Atoi(line); err == nil {
-			scan.nodeCache.Containers[containerId].AddProcess(pid)
-			scan.nodeCache.Containers[containerId].Processes[pid] =  &Process{
-				Pid: pid,
-				Parent: container,
-			}
+	if scan.nodeCache.Containers[containerId] == nil {
+		scan.nodeCache.Containers[containerId] = NewContainer(containerId)
+		// deleteContainer finds the containers of a pod by their parent
+		scan.nodeCache.Containers[containerId].Parent = container.Parent
+	}
+	for _, pid := range pids {
+		scan.nodeCache.Containers[containerId].AddProcess(pid)
+		scan.nodeCache.Containers[containerId].Processes[pid] =  &Process{
+			Pid: pid,
+			Parent: container,
 		}
 	}
-	klog.V(4).Infof("Read from %s, pids", procPath, scan.nodeCache.Containers[containerId].Processes)
+	klog.V(4).Infof("Read from %s, pids %v", procPath, scan.nodeCache.Containers[containerId].Processes)
 	return scan.nodeCache.Containers[containerId].Processes, nil
 }
 
@@ -1,3 +1,194 @@
 package ptree
 
-// TODO: implement Scanner here
\ No newline at end of file
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"k8s.io/klog"
+)
+
+const (
+	// procStatus is the file holding the thread group ID of a thread.
+	procStatus = "status"
+	// cgroup2Magic is the filesystem type of a unified (v2) hierarchy.
+	cgroup2Magic = 0x63677270
+	// cgroupControllers only exists at the root of a unified hierarchy.
+	cgroupControllers = "cgroup.controllers"
+	// CgroupThreads and CgroupTasks list the threads of a cgroup, in a unified
+	// hierarchy and in a v1 one.
+	CgroupThreads = "cgroup.threads"
+	CgroupTasks   = "tasks"
+)
+
+// IsCgroupV2 tells whether root is the mount point of a unified hierarchy.
+func IsCgroupV2(fs FS, root string) bool {
+	if typer, ok := fs.(fsTyper); ok {
+		if fsType, err := typer.FSType(root); err == nil && fsType == cgroup2Magic {
+			return true
+		}
+	}
+	return exists(fs, filepath.Join(root, cgroupControllers))
+}
+
+// CgroupV2Scanner scans the pods in a unified hierarchy, where the cgroup of a
+// container holds the processes of all controllers. Every scan reads the tree
+// again, so it keeps no state about pods.
+type CgroupV2Scanner struct {
+	fs       FS
+	root     string
+	resolver PathResolver
+	opts     ScanOptions
+}
+
+func NewCgroupV2Scanner(fs FS, root string, resolver PathResolver, opts ScanOptions) Scanner {
+	return &CgroupV2Scanner{
+		fs:       fs,
+		root:     root,
+		resolver: resolver,
+		opts:     opts,
+	}
+}
+
+func (scan *CgroupV2Scanner) Scan(UID, QOS string) (Pod, error, bool) {
+	podPath := filepath.Join(scan.root, scan.resolver.PodPath(UID, QOS))
+	if !exists(scan.fs, podPath) {
+		return Pod{}, nil, false
+	}
+	fileList, err := scan.fs.ReadDir(podPath)
+	if err != nil {
+		klog.Errorf("Can't read %s, %v", podPath, err)
+		return Pod{}, err, true
+	}
+	pod := NewPod(QOS, UID)
+	for _, file := range fileList {
+		containerID, ok := scan.resolver.ContainerID(file.Name())
+		if !file.IsDir() || !ok {
+			continue
+		}
+		container := pod.AddContainer(containerID)
+		procPath := filepath.Join(podPath, file.Name(), CgroupProcs)
+		pids, err := containerPids(scan.fs, filepath.Dir(procPath), CgroupThreads, scan.opts)
+		if err != nil {
+			if os.IsNotExist(err) {
+				// the container went away while we were scanning
+				delete(pod.Containers, containerID)
+				continue
+			}
+			klog.Errorf("Cannot read the pid in the container: %s, %v", containerID, err)
+			return Pod{}, err, true
+		}
+		for _, pid := range pids {
+			container.AddProcess(pid)
+		}
+		klog.V(4).Infof("Read from %s, pids %v", procPath, pids)
+	}
+	return *pod, nil, true
+}
+
+func (scan *CgroupV2Scanner) deletePod(UID string) {}
+
+func (scan *CgroupV2Scanner) deleteContainer(UID string) {}
+
+// ScanOptions tunes how the cgroup scanners look for the processes of a container.
+type ScanOptions struct {
+	// MaxDepth is how many levels of child cgroups below a container cgroup are
+	// walked, for containers which create their own cgroups. 0 reads the container
+	// cgroup only.
+	MaxDepth int
+	// ProcRoot is the procfs used to resolve the threads of child cgroups to the ID
+	// of their thread group leader. Every child cgroup then has both its processes
+	// and its threads file read, which finds the processes of threaded cgroups
+	// whose processes cannot be listed. Without it only the processes are read.
+	ProcRoot string
+}
+
+// containerPids reads the processes of a container cgroup and of its child cgroups
+// down to opts.MaxDepth levels. Only the container cgroup itself has to exist,
+// children may go away while they are walked. With opts.ProcRoot the threads of
+// the children, listed in their threads file, are resolved to their processes too:
+// a threaded cgroup of a unified hierarchy cannot list its processes.
+func containerPids(fs FS, dir, threads string, opts ScanOptions) ([]int, error) {
+	seen := make(map[int]struct{})
+	var pids []int
+	var walk func(dir string, depth int) error
+	walk = func(dir string, depth int) error {
+		found, err := readProcs(fs, filepath.Join(dir, CgroupProcs))
+		if depth > 0 && opts.ProcRoot != "" {
+			if tids, threadsErr := readProcs(fs, filepath.Join(dir, threads)); threadsErr == nil {
+				for _, tid := range tids {
+					found = append(found, threadGroup(fs, opts.ProcRoot, tid))
+				}
+				err = nil
+			}
+		}
+		if err != nil {
+			return err
+		}
+		for _, pid := range found {
+			if _, ok := seen[pid]; !ok {
+				seen[pid] = struct{}{}
+				pids = append(pids, pid)
+			}
+		}
+		if depth >= opts.MaxDepth {
+			return nil
+		}
+		children, err := fs.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+		for _, child := range children {
+			if !child.IsDir() {
+				continue
+			}
+			if err := walk(filepath.Join(dir, child.Name()), depth+1); err != nil && !os.IsNotExist(err) {
+				klog.V(4).Infof("Cannot read cgroup %s: %v", filepath.Join(dir, child.Name()), err)
+			}
+		}
+		return nil
+	}
+	return pids, walk(dir, 0)
+}
+
+// threadGroup returns the thread group leader of a thread, or tid itself when its
+// status cannot be read.
+func threadGroup(fs FS, procRoot string, tid int) int {
+	file, err := fs.Open(filepath.Join(procRoot, strconv.Itoa(tid), procStatus))
+	if err != nil {
+		return tid
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "Tgid:") {
+			continue
+		}
+		if tgid, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "Tgid:"))); err == nil && tgid > 0 {
+			return tgid
+		}
+		break
+	}
+	return tid
+}
+
+// readProcs reads the pids in a cgroup.procs file, or the thread IDs in a threads
+// file.
+func readProcs(fs FS, procPath string) ([]int, error) {
+	file, err := fs.Open(procPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var pids []int
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if pid, err := strconv.Atoi(scanner.Text()); err == nil {
+			pids = append(pids, pid)
+		}
+	}
+	return pids, scanner.Err()
+}
@@ -0,0 +1,192 @@
+package ptree
+
+import (
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+const (
+	testRoot = "/host/sys/fs/cgroup"
+	testUID  = "17eb80b0-6085-4d12-8e79-553e799d2f0b"
+)
+
+var (
+	containerA = strings.Repeat("a", 64)
+	containerB = strings.Repeat("b", 64)
+)
+
+// cgroupfsV2 is a unified tree laid out by the cgroupfs driver, with a burstable pod
+// running containers a and b.
+func cgroupfsV2() map[string]string {
+	pod := filepath.Join(testRoot, "kubepods/burstable/pod"+testUID)
+	return map[string]string{
+		filepath.Join(testRoot, cgroupControllers):           "cpu memory pids",
+		filepath.Join(pod, CgroupProcs):                      "",
+		filepath.Join(pod, containerA, CgroupProcs):          "100\n101\n",
+		filepath.Join(pod, containerB, CgroupProcs):          "200\n",
+		filepath.Join(pod, containerB, "memory.max"):         "max",
+		filepath.Join(testRoot, "system.slice/cgroup.procs"): "1\n",
+	}
+}
+
+// systemdV2 is the same pod laid out by the systemd driver under CRI-O, whose
+// conmon scopes sit beside the containers.
+func systemdV2() map[string]string {
+	pod := filepath.Join(testRoot, "kubepods.slice/kubepods-burstable.slice",
+		"kubepods-burstable-pod"+strings.Replace(testUID, "-", "_", -1)+".slice")
+	return map[string]string{
+		filepath.Join(testRoot, cgroupControllers):                          "cpu memory pids",
+		filepath.Join(pod, "crio-"+containerA+".scope", CgroupProcs):        "100\n101\n",
+		filepath.Join(pod, "crio-conmon-"+containerA+".scope", CgroupProcs): "99\n",
+		filepath.Join(pod, "crio-"+containerB+".scope", CgroupProcs):        "200\n",
+	}
+}
+
+// pids returns the sorted pids of every container of a pod.
+func pids(pod Pod) map[string][]int {
+	found := make(map[string][]int)
+	for id, container := range pod.Containers {
+		found[id] = []int{}
+		for pid := range container.Processes {
+			found[id] = append(found[id], pid)
+		}
+		sort.Ints(found[id])
+	}
+	return found
+}
+
+func newV2Scanner(t *testing.T, fs FS, opts ScanOptions) Scanner {
+	t.Helper()
+	scanner, err := NewScanner(fs, "/host/sys", CgroupDriverAuto, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := scanner.(*CgroupV2Scanner); !ok {
+		t.Fatalf("NewScanner() = %T, want a cgroup v2 scanner", scanner)
+	}
+	return scanner
+}
+
+func TestIsCgroupV2(t *testing.T) {
+	if !IsCgroupV2(newMapFS(cgroupfsV2()), testRoot) {
+		t.Error("unified tree with cgroup.controllers not detected")
+	}
+	v1 := newMapFS(map[string]string{
+		filepath.Join(testRoot, "memory", CgroupProcs): "1\n",
+		filepath.Join(testRoot, "cpu", CgroupProcs):    "1\n",
+	})
+	if IsCgroupV2(v1, testRoot) {
+		t.Error("v1 tree detected as unified")
+	}
+	v1.magic = cgroup2Magic
+	if !IsCgroupV2(v1, testRoot) {
+		t.Error("cgroup2 filesystem type not detected")
+	}
+}
+
+func TestCgroupV2Scanner(t *testing.T) {
+	want := map[string][]int{containerA: {100, 101}, containerB: {200}}
+	for _, tc := range []struct {
+		name  string
+		files map[string]string
+	}{
+		{name: "cgroupfs", files: cgroupfsV2()},
+		{name: "systemd", files: systemdV2()},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			scanner := newV2Scanner(t, newMapFS(tc.files), ScanOptions{})
+			pod, err, exist := scanner.Scan(testUID, QOSBurstable)
+			if err != nil || !exist {
+				t.Fatalf("Scan() = %v, %v", err, exist)
+			}
+			if got := pids(pod); !reflect.DeepEqual(got, want) {
+				t.Errorf("pids of the pod = %v, want %v", got, want)
+			}
+			if _, err, exist := scanner.Scan(testUID, QOSGuaranteed); err != nil || exist {
+				t.Errorf("Scan() of a pod in the wrong qos class = %v, %v, want it missing", err, exist)
+			}
+		})
+	}
+}
+
+func TestCgroupV2ScannerContainerGone(t *testing.T) {
+	fs := newMapFS(cgroupfsV2())
+	pod := filepath.Join(testRoot, "kubepods/burstable/pod"+testUID)
+	// container b exits once the pod was listed, before its cgroup is read
+	fs.afterReadDir = func(name string) {
+		if name == pod {
+			fs.remove(filepath.Join(pod, containerB))
+		}
+	}
+	scanned, err, exist := newV2Scanner(t, fs, ScanOptions{}).Scan(testUID, QOSBurstable)
+	if err != nil || !exist {
+		t.Fatalf("Scan() = %v, %v", err, exist)
+	}
+	if got, want := pids(scanned), map[string][]int{containerA: {100, 101}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("pids of the pod = %v, want %v", got, want)
+	}
+}
+
+func TestCgroupV2ScannerChildCgroups(t *testing.T) {
+	files := cgroupfsV2()
+	container := filepath.Join(testRoot, "kubepods/burstable/pod"+testUID, containerA)
+	files[filepath.Join(container, "init", CgroupProcs)] = "102\n"
+	files[filepath.Join(container, "init/worker", CgroupProcs)] = "103\n"
+	for _, tc := range []struct {
+		depth int
+		want  []int
+	}{
+		{depth: 0, want: []int{100, 101}},
+		{depth: 1, want: []int{100, 101, 102}},
+		{depth: 2, want: []int{100, 101, 102, 103}},
+	} {
+		pod, err, _ := newV2Scanner(t, newMapFS(files), ScanOptions{MaxDepth: tc.depth}).Scan(testUID, QOSBurstable)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := pids(pod)[containerA]; !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("depth %d: pids of container a = %v, want %v", tc.depth, got, tc.want)
+		}
+	}
+}
+
+// status is the status file of a thread in procfs.
+func status(tgid, pid int) string {
+	return "Name:\tworker\nTgid:\t" + strconv.Itoa(tgid) + "\nPid:\t" + strconv.Itoa(pid) + "\n"
+}
+
+func TestCgroupV2ScannerThreadedCgroup(t *testing.T) {
+	files := cgroupfsV2()
+	worker := filepath.Join(testRoot, "kubepods/burstable/pod"+testUID, containerA, "worker")
+	// threads 111 and 112 of process 110 run in a threaded child cgroup, whose
+	// cgroup.procs cannot be read
+	files[filepath.Join(worker, CgroupProcs)] = ""
+	files[filepath.Join(worker, CgroupThreads)] = "111\n112\n"
+	files[filepath.Join("/host/proc/111", procStatus)] = status(110, 111)
+	files[filepath.Join("/host/proc/112", procStatus)] = status(110, 112)
+	for _, tc := range []struct {
+		name string
+		opts ScanOptions
+		want []int
+	}{
+		{name: "threads kept out", opts: ScanOptions{MaxDepth: 1}, want: []int{100, 101}},
+		{name: "threads resolved", opts: ScanOptions{MaxDepth: 1, ProcRoot: "/host/proc"}, want: []int{100, 101, 110}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fs := newMapFS(files)
+			fs.broken = map[string]error{filepath.Join(worker, CgroupProcs): syscall.EOPNOTSUPP}
+			pod, err, _ := newV2Scanner(t, fs, tc.opts).Scan(testUID, QOSBurstable)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := pids(pod)[containerA]; !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("pids of container a = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package ptree
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"k8s.io/klog"
+)
+
+const (
+	// procCgroup is the file listing the cgroups of a process.
+	procCgroup = "cgroup"
+	// procComm is the file holding the command name of a process.
+	procComm = "comm"
+)
+
+// podSegment matches the pod part of a cgroup path for both the cgroupfs driver
+// (pod<uid>) and the systemd driver (kubepods-burstable-pod<uid_with_underscores>.slice).
+var podSegment = regexp.MustCompile(`pod([0-9a-f]{8}[-_][0-9a-f]{4}[-_][0-9a-f]{4}[-_][0-9a-f]{4}[-_][0-9a-f]{12})`)
+
+// PidScanner attributes the processes running on the gpus to pods by reading their
+// /proc/<pid>/cgroup, instead of walking the cgroups of every pod. Its cost grows
+// with the gpu processes only, and it does not depend on the cgroup layout.
+type PidScanner struct {
+	fs       FS
+	procRoot string
+	pids     func() ([]int, error)
+	mu       sync.Mutex
+	pods     map[string]*Pod
+}
+
+// NewPidScanner returns a scanner reading the procfs at procRoot; pids lists the
+// processes running on the gpus.
+func NewPidScanner(fs FS, procRoot string, pids func() ([]int, error)) *PidScanner {
+	return &PidScanner{
+		fs:       fs,
+		procRoot: procRoot,
+		pids:     pids,
+		mu:       sync.Mutex{},
+		pods:     make(map[string]*Pod),
+	}
+}
+
+// refresh reads the cgroups of the gpu processes, once for every snapshot.
+func (scan *PidScanner) refresh() error {
+	pids, err := scan.pids()
+	if err != nil {
+		return err
+	}
+	pods := make(map[string]*Pod)
+	for _, pid := range pids {
+		UID, containerID, err := PodOfProcess(scan.fs, scan.procRoot, pid)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				klog.Errorf("Cannot read the cgroup of pid %d: %v", pid, err)
+			}
+			continue
+		}
+		if UID == "" {
+			klog.V(4).Infof("Pid %d does not run in a pod", pid)
+			continue
+		}
+		pod, ok := pods[UID]
+		if !ok {
+			pod = NewPod("", UID)
+			pods[UID] = pod
+		}
+		container, ok := pod.Containers[containerID]
+		if !ok {
+			container = pod.AddContainer(containerID)
+		}
+		container.AddProcess(pid)
+	}
+	scan.mu.Lock()
+	defer scan.mu.Unlock()
+	scan.pods = pods
+	return nil
+}
+
+// Scan returns the gpu processes of a pod found by the last refresh. A pod with
+// none is returned empty: the pod still exists, it does not use a gpu.
+func (scan *PidScanner) Scan(UID, QOS string) (Pod, error, bool) {
+	scan.mu.Lock()
+	defer scan.mu.Unlock()
+	pod, ok := scan.pods[UID]
+	if !ok {
+		return *NewPod(QOS, UID), nil, true
+	}
+	found := *pod
+	found.QOS = QOS
+	return found, nil, true
+}
+
+func (scan *PidScanner) deletePod(UID string) {}
+
+func (scan *PidScanner) deleteContainer(UID string) {}
+
+// PodOfProcess returns the pod UID and container ID of a pid, both empty when the
+// process is not in a pod.
+func PodOfProcess(fs FS, procRoot string, pid int) (string, string, error) {
+	file, err := fs.Open(filepath.Join(procRoot, strconv.Itoa(pid), procCgroup))
+	if err != nil {
+		return "", "", err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// hierarchy-ID:controller-list:cgroup-path
+		fields := strings.SplitN(scanner.Text(), ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		if UID, containerID := parseCgroupPath(fields[2]); UID != "" {
+			return UID, containerID, nil
+		}
+	}
+	return "", "", scanner.Err()
+}
+
+// ProcessInfo returns the command name and the cgroup of a pid, empty for what
+// cannot be read. With cgroup v1 the memory cgroup is returned.
+func ProcessInfo(fs FS, procRoot string, pid int) (string, string) {
+	var command, cgroup string
+	dir := filepath.Join(procRoot, strconv.Itoa(pid))
+	if file, err := fs.Open(filepath.Join(dir, procComm)); err == nil {
+		scanner := bufio.NewScanner(file)
+		if scanner.Scan() {
+			command = strings.TrimSpace(scanner.Text())
+		}
+		file.Close()
+	}
+	if file, err := fs.Open(filepath.Join(dir, procCgroup)); err == nil {
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			// hierarchy-ID:controller-list:cgroup-path
+			fields := strings.SplitN(scanner.Text(), ":", 3)
+			if len(fields) != 3 {
+				continue
+			}
+			if fields[1] == "" || fields[1] == memoryController {
+				cgroup = fields[2]
+			}
+			if fields[1] == memoryController {
+				break
+			}
+		}
+		file.Close()
+	}
+	return command, cgroup
+}
+
+// parseCgroupPath reads the pod UID and the container ID from a cgroup path. The
+// container is the first cgroup below the pod named after a container ID.
+func parseCgroupPath(cgroupPath string) (string, string) {
+	segments := strings.Split(strings.Trim(cgroupPath, "/"), "/")
+	for i, segment := range segments {
+		match := podSegment.FindStringSubmatch(segment)
+		if match == nil {
+			continue
+		}
+		UID := strings.Replace(match[1], "_", "-", -1)
+		for _, child := range segments[i+1:] {
+			if containerID, ok := scopeContainerID(child); ok {
+				return UID, containerID
+			}
+		}
+		return UID, ""
+	}
+	return "", ""
+}
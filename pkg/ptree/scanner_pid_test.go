@@ -0,0 +1,83 @@
+package ptree
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+const testProc = "/host/proc"
+
+// procCgroups is the procfs of the processes running on the gpus: pids 100 and
+// 101 in container a under cgroup v1, 200 in container b under the systemd driver
+// and cgroup v2, 300 outside any pod. Pid 400 exited.
+func procCgroups() map[string]string {
+	cgroup := func(pid int) string {
+		return filepath.Join(testProc, strconv.Itoa(pid), procCgroup)
+	}
+	v1 := "12:memory:/kubepods/burstable/pod" + testUID + "/" + containerA + "\n" +
+		"11:cpu,cpuacct:/kubepods/burstable/pod" + testUID + "/" + containerA + "\n"
+	return map[string]string{
+		cgroup(100): v1,
+		cgroup(101): v1,
+		cgroup(200): "0::/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod" +
+			"17eb80b0_6085_4d12_8e79_553e799d2f0b.slice/cri-containerd-" + containerB + ".scope\n",
+		cgroup(300):                              "0::/system.slice/xorg.service\n",
+		filepath.Join(testProc, "300", procComm): "Xorg\n",
+	}
+}
+
+func TestPidScanner(t *testing.T) {
+	scanner := NewPidScanner(newMapFS(procCgroups()), testProc, func() ([]int, error) {
+		return []int{100, 101, 200, 300, 400}, nil
+	})
+	if err := scanner.refresh(); err != nil {
+		t.Fatal(err)
+	}
+	pod, err, exist := scanner.Scan(testUID, QOSBurstable)
+	if err != nil || !exist {
+		t.Fatalf("Scan() = %v, %v", err, exist)
+	}
+	want := map[string][]int{containerA: {100, 101}, containerB: {200}}
+	if got := pids(pod); !reflect.DeepEqual(got, want) || pod.QOS != QOSBurstable {
+		t.Errorf("Scan() = %v in %q, want %v in %q", got, pod.QOS, want, QOSBurstable)
+	}
+	other, err, exist := scanner.Scan("0f6c2a3e-8d1b-4c55-9a7e-2b3c4d5e6f70", QOSBestEffort)
+	if err != nil || !exist || len(other.Containers) != 0 {
+		t.Errorf("Scan() of a pod without gpu processes = %v, %v, %v, want it empty", other, err, exist)
+	}
+}
+
+func TestPidScannerKeepsPodsWhenPidsFail(t *testing.T) {
+	fail := false
+	scanner := NewPidScanner(newMapFS(procCgroups()), testProc, func() ([]int, error) {
+		if fail {
+			return nil, errors.New("nvml lost")
+		}
+		return []int{200}, nil
+	})
+	if err := scanner.refresh(); err != nil {
+		t.Fatal(err)
+	}
+	fail = true
+	if err := scanner.refresh(); err == nil {
+		t.Fatal("refresh() did not fail with the pids")
+	}
+	pod, _, _ := scanner.Scan(testUID, QOSBurstable)
+	if got, want := pids(pod), map[string][]int{containerB: {200}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("pids after a failed refresh = %v, want %v", got, want)
+	}
+}
+
+func TestProcessInfo(t *testing.T) {
+	fs := newMapFS(procCgroups())
+	if command, cgroup := ProcessInfo(fs, testProc, 300); command != "Xorg" || cgroup != "/system.slice/xorg.service" {
+		t.Errorf("ProcessInfo(300) = %q, %q", command, cgroup)
+	}
+	wantV1 := "/kubepods/burstable/pod" + testUID + "/" + containerA
+	if command, cgroup := ProcessInfo(fs, testProc, 100); command != "" || cgroup != wantV1 {
+		t.Errorf("ProcessInfo(100) = %q, %q, want the memory cgroup %q", command, cgroup, wantV1)
+	}
+}
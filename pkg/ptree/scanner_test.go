@@ -0,0 +1,112 @@
+package ptree
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// cgroupfsV1 is the memory hierarchy of a v1 tree laid out by the cgroupfs driver,
+// with a burstable pod running containers a and b.
+func cgroupfsV1() map[string]string {
+	pod := filepath.Join(testRoot, memoryController, "kubepods/burstable/pod"+testUID)
+	return map[string]string{
+		filepath.Join(testRoot, memoryController, CgroupProcs): "1\n",
+		filepath.Join(pod, CgroupProcs):                        "",
+		filepath.Join(pod, containerA, CgroupProcs):            "100\n101\n",
+		filepath.Join(pod, containerB, CgroupProcs):            "200\n",
+		filepath.Join(testRoot, "cpu", CgroupProcs):            "1\n",
+	}
+}
+
+// systemdV1 is the same pod laid out by the systemd driver under docker.
+func systemdV1() map[string]string {
+	pod := filepath.Join(testRoot, memoryController, "kubepods.slice/kubepods-burstable.slice",
+		"kubepods-burstable-pod"+strings.Replace(testUID, "-", "_", -1)+".slice")
+	return map[string]string{
+		filepath.Join(pod, "docker-"+containerA+".scope", CgroupProcs): "100\n101\n",
+		filepath.Join(pod, "docker-"+containerB+".scope", CgroupProcs): "200\n",
+	}
+}
+
+func newV1Scanner(t *testing.T, fs FS, opts ScanOptions) *ScannerImpl {
+	t.Helper()
+	scanner, err := NewScanner(fs, "/host/sys", CgroupDriverAuto, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v1, ok := scanner.(*ScannerImpl)
+	if !ok {
+		t.Fatalf("NewScanner() = %T, want a cgroup v1 scanner", scanner)
+	}
+	return v1
+}
+
+func TestScannerImpl(t *testing.T) {
+	want := map[string][]int{containerA: {100, 101}, containerB: {200}}
+	for _, tc := range []struct {
+		name  string
+		files map[string]string
+	}{
+		{name: "cgroupfs", files: cgroupfsV1()},
+		{name: "systemd", files: systemdV1()},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			scanner := newV1Scanner(t, newMapFS(tc.files), ScanOptions{})
+			pod, err, exist := scanner.Scan(testUID, QOSBurstable)
+			if err != nil || !exist {
+				t.Fatalf("Scan() = %v, %v", err, exist)
+			}
+			if got := pids(pod); !reflect.DeepEqual(got, want) {
+				t.Errorf("pids of the pod = %v, want %v", got, want)
+			}
+			if _, err, exist := scanner.Scan(testUID, QOSBestEffort); err != nil || exist {
+				t.Errorf("Scan() of a pod in the wrong qos class = %v, %v, want it missing", err, exist)
+			}
+		})
+	}
+}
+
+func TestScannerImplForgetsPods(t *testing.T) {
+	fs := newMapFS(cgroupfsV1())
+	scanner := newV1Scanner(t, fs, ScanOptions{})
+	if _, err, _ := scanner.Scan(testUID, QOSBurstable); err != nil {
+		t.Fatal(err)
+	}
+	scanner.deleteContainer(testUID)
+	for _, id := range []string{containerA, containerB} {
+		if _, ok := scanner.nodeCache.Containers[id]; ok {
+			t.Errorf("container %s of the deleted pod still cached", id[:12])
+		}
+	}
+	scanner.deletePod(testUID)
+	if _, ok := scanner.nodeCache.Pods[testUID]; ok {
+		t.Error("deleted pod still cached")
+	}
+
+	fs.remove(filepath.Join(testRoot, memoryController, "kubepods/burstable/pod"+testUID))
+	if _, err, exist := scanner.Scan(testUID, QOSBurstable); err != nil || exist {
+		t.Errorf("Scan() of a removed pod = %v, %v, want it missing", err, exist)
+	}
+}
+
+func TestScannerImplResolvesTasks(t *testing.T) {
+	files := cgroupfsV1()
+	child := filepath.Join(testRoot, memoryController, "kubepods/burstable/pod"+testUID, containerA, "worker")
+	// thread 121 of process 120 was moved to the child without its leader
+	files[filepath.Join(child, CgroupProcs)] = "120\n"
+	files[filepath.Join(child, CgroupTasks)] = "121\n"
+	files[filepath.Join("/host/proc/121", procStatus)] = status(120, 121)
+	files[filepath.Join(child, "deeper", CgroupProcs)] = ""
+	files[filepath.Join(child, "deeper", CgroupTasks)] = "122\n"
+	files[filepath.Join("/host/proc/122", procStatus)] = status(122, 122)
+	scanner := newV1Scanner(t, newMapFS(files), ScanOptions{MaxDepth: 2, ProcRoot: "/host/proc"})
+	pod, err, _ := scanner.Scan(testUID, QOSBurstable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := pids(pod)[containerA], []int{100, 101, 120, 122}; !reflect.DeepEqual(got, want) {
+		t.Errorf("pids of container a = %v, want %v", got, want)
+	}
+}
@@ -90,12 +90,49 @@ type Process struct {
 	Parent *Container
 }
 
+// Kinds of GPU context a process holds.
+const (
+	ContextCompute  = "compute"
+	ContextGraphics = "graphics"
+	ContextMixed    = "compute+graphics"
+	// ContextMPS is a compute client of an MPS server running on the same card.
+	ContextMPS = "mps"
+)
+
+var Contexts = []string{ContextCompute, ContextGraphics, ContextMixed, ContextMPS}
+
+// MIGSlice is the MIG GPU instance and compute instance a process runs in.
+type MIGSlice struct {
+	GPUInstance     int
+	ComputeInstance int
+}
+
+// ProcessUsage is what a process used on a card. GPUCore, GPUEnc, GPUDec and
+// GPUMemBandwidth are utilization in percent of the card, GPUMem is in MiB.
 type ProcessUsage struct {
-	GPUCore float64
-	GPUMem  float64
+	GPUCore         float64
+	GPUMem          float64
+	GPUEnc          float64
+	GPUDec          float64
+	GPUMemBandwidth float64
+	Context         string
+	// MIG is nil unless the card is in MIG mode.
+	MIG *MIGSlice
 }
 
 type CardUsage struct {
-	Core float64
-	Mem  float64
+	Core         float64
+	Mem          float64
+	Enc          float64
+	Dec          float64
+	MemBandwidth float64
+}
+
+// Add adds the usage of a process.
+func (u *CardUsage) Add(usage *ProcessUsage) {
+	u.Core += usage.GPUCore
+	u.Mem += usage.GPUMem
+	u.Enc += usage.GPUEnc
+	u.Dec += usage.GPUDec
+	u.MemBandwidth += usage.GPUMemBandwidth
 }
\ No newline at end of file
@@ -2,9 +2,13 @@ package util
 
 const (
 	NodeNameField = "spec.nodeName"
-	ContainerID = "docker://%s"
+	// RuntimeSeparator ends the runtime prefix of a container ID in the pod status,
+	// e.g. docker://, containerd:// or cri-o://.
+	RuntimeSeparator = "://"
     ResourceGPUMemory = "tke.cloud.tencent.com/qgpu-memory"
     ResourceGPUCore   = "tke.cloud.tencent.com/qgpu-core"
 	ResourceGPUPercent   = "nano-gpu/gpu-percent"
+	// Resources is the default of --labels, the resources whose pods are watched.
+	Resources = "nvidia.com/gpu, tke.cloud.tencent.com/qgpu-core, tke.cloud.tencent.com/qgpu-memory, nano-gpu/gpu-percent"
 )
 
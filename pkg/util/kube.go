@@ -25,3 +25,15 @@ func PodHasResource(pod *v1.Pod, set map[string]struct{}) bool {
 	}
 	return false
 }
+
+// SplitResources splits a comma separated list of resource names, dropping the
+// spaces around every name and the empty ones.
+func SplitResources(list string) []string {
+	var names []string
+	for _, name := range strings.Split(list, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
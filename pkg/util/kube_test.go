@@ -0,0 +1,45 @@
+package util
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestSplitResources(t *testing.T) {
+	for _, tc := range []struct {
+		list string
+		want []string
+	}{
+		{
+			list: Resources,
+			want: []string{"nvidia.com/gpu", ResourceGPUCore, ResourceGPUMemory, ResourceGPUPercent},
+		},
+		{list: "nvidia.com/gpu", want: []string{"nvidia.com/gpu"}},
+		{list: " nvidia.com/gpu ,,nano-gpu/gpu-percent,", want: []string{"nvidia.com/gpu", ResourceGPUPercent}},
+		{list: ""},
+	} {
+		if got := SplitResources(tc.list); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("SplitResources(%q) = %q, want %q", tc.list, got, tc.want)
+		}
+	}
+}
+
+func TestPodHasResourceOfDefaultLabels(t *testing.T) {
+	set := make(map[string]struct{})
+	for _, name := range SplitResources(Resources) {
+		set[name] = struct{}{}
+	}
+	for _, name := range []string{"nvidia.com/gpu", ResourceGPUCore, ResourceGPUMemory, ResourceGPUPercent} {
+		pod := &v1.Pod{Spec: v1.PodSpec{Containers: []v1.Container{{
+			Resources: v1.ResourceRequirements{Limits: v1.ResourceList{
+				v1.ResourceName(name): resource.MustParse("1"),
+			}},
+		}}}}
+		if !PodHasResource(pod, set) {
+			t.Errorf("pod limited in %s not watched with the default labels", name)
+		}
+	}
+}
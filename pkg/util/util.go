@@ -4,6 +4,7 @@ import (
 	"fmt"
 	v1 "k8s.io/api/core/v1"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -64,4 +65,13 @@ func IsCompletePod(pod *v1.Pod) bool {
 
 func IsAssumed(pod *v1.Pod) bool {
 	return pod.ObjectMeta.Annotations[AnnotationQGPUAssume] == "true"
-}
\ No newline at end of file
+}
+
+// NormalizeContainerID drops the runtime prefix of a container ID, whatever the
+// runtime is, so that IDs from the pod status match the ones read from cgroups.
+func NormalizeContainerID(id string) string {
+	if i := strings.Index(id, RuntimeSeparator); i >= 0 {
+		id = id[i+len(RuntimeSeparator):]
+	}
+	return id
+}